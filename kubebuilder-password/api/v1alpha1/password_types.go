@@ -17,22 +17,228 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"strings"
+
+	passwordGenerator "github.com/sethvargo/go-password/password"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// PasswordState is the sync state of a copy of the Secret.
 type PasswordState string
 
+// Condition types of Password.
+const (
+	// ConditionReady reports whether the last reconciliation of the Password succeeded.
+	ConditionReady = "Ready"
+	// ConditionSecretCreated reports whether the Secret owned by the Password exists.
+	ConditionSecretCreated = "SecretCreated"
+	// ConditionRotated reports whether the value of the Secret was (re)generated by the controller.
+	ConditionRotated = "Rotated"
+	// ConditionPolicySatisfied reports whether a value satisfying the spec could be generated.
+	ConditionPolicySatisfied = "PolicySatisfied"
+	// ConditionPushed reports whether the value was written to spec.pushTo.
+	ConditionPushed = "Pushed"
+	// ConditionExpired reports whether the value of the Secret outlived spec.ttl.
+	ConditionExpired = "Expired"
+)
+
 const (
 	PasswordInSync PasswordState = "InSync"
 	PasswordFailed PasswordState = "Failed"
 )
 
+// GeneratorType selects the algorithm used to generate the Secret value.
+// +kubebuilder:validation:Enum=Password;Passphrase;Hex;Base64;UUID;RSA;ECDSA;Ed25519
+type GeneratorType string
+
+const (
+	// GeneratorPassword generates a random password with sethvargo/go-password.
+	GeneratorPassword GeneratorType = "Password"
+	// GeneratorPassphrase generates a diceware-style passphrase from the embedded wordlist.
+	GeneratorPassphrase GeneratorType = "Passphrase"
+	// GeneratorHex generates N random bytes encoded as hex.
+	GeneratorHex GeneratorType = "Hex"
+	// GeneratorBase64 generates N random bytes encoded as base64.
+	GeneratorBase64 GeneratorType = "Base64"
+	// GeneratorUUID generates a random (version 4) UUID.
+	GeneratorUUID GeneratorType = "UUID"
+	// GeneratorRSA generates an RSA keypair.
+	GeneratorRSA GeneratorType = "RSA"
+	// GeneratorECDSA generates an ECDSA keypair.
+	GeneratorECDSA GeneratorType = "ECDSA"
+	// GeneratorEd25519 generates an Ed25519 keypair.
+	GeneratorEd25519 GeneratorType = "Ed25519"
+)
+
+// RetainPolicy decides what happens to the Secret when its Password is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain
+type RetainPolicy string
+
+const (
+	// RetainPolicyDelete deletes the Secret together with the Password, after spec.deletionDelay if set.
+	RetainPolicyDelete RetainPolicy = "Delete"
+	// RetainPolicyRetain keeps the Secret, its history, its copies and its sealed values when the Password is deleted.
+	RetainPolicyRetain RetainPolicy = "Retain"
+)
+
+// ImportPolicy decides what happens to a Secret that already exists but is not owned by the Password.
+// +kubebuilder:validation:Enum=Fail;Adopt;Overwrite
+type ImportPolicy string
+
+const (
+	// ImportPolicyFail leaves the Secret alone and reports the Password as not ready.
+	ImportPolicyFail ImportPolicy = "Fail"
+	// ImportPolicyAdopt takes ownership of the Secret and keeps its value if it satisfies the spec.
+	ImportPolicyAdopt ImportPolicy = "Adopt"
+	// ImportPolicyOverwrite takes ownership of the Secret and replaces its value.
+	ImportPolicyOverwrite ImportPolicy = "Overwrite"
+)
+
+// ExpirePolicy decides what happens to the Secret when its value outlives spec.ttl.
+// +kubebuilder:validation:Enum=Delete;Regenerate
+type ExpirePolicy string
+
+const (
+	// ExpirePolicyDelete deletes the Secret and its copies. They are not created again
+	// until spec.ttl is removed or extended.
+	ExpirePolicyDelete ExpirePolicy = "Delete"
+	// ExpirePolicyRegenerate replaces the value of the Secret with a new one.
+	ExpirePolicyRegenerate ExpirePolicy = "Regenerate"
+)
+
+// KeyFormat is the encoding of a generated keypair.
+// +kubebuilder:validation:Enum=PEM;OpenSSH
+type KeyFormat string
+
+const (
+	// KeyFormatPEM encodes the private key as PKCS#8 and the public key as PKIX, both PEM armored.
+	KeyFormatPEM KeyFormat = "PEM"
+	// KeyFormatOpenSSH encodes the private key as an OpenSSH private key and the public key in authorized_keys format.
+	KeyFormatOpenSSH KeyFormat = "OpenSSH"
+)
+
+// PassphraseSpec configures the Passphrase generator.
+type PassphraseSpec struct {
+	// Number of words in the passphrase.
+	// +kubebuilder:validation:Minimum=3
+	// +kubebuilder:validation:Maximum=32
+	// +kubebuilder:default:=6
+	// +kubebuilder:validation:Optional
+	Words int `json:"words,omitempty"`
+
+	// Separator placed between words.
+	// +kubebuilder:default:="-"
+	// +kubebuilder:validation:Optional
+	Separator string `json:"separator,omitempty"`
+}
+
+// TokenSpec configures the Hex and Base64 generators.
+type TokenSpec struct {
+	// Number of random bytes before encoding.
+	// +kubebuilder:validation:Minimum=8
+	// +kubebuilder:validation:Maximum=1024
+	// +kubebuilder:default:=32
+	// +kubebuilder:validation:Optional
+	Bytes int `json:"bytes,omitempty"`
+}
+
+// KeyPairSpec configures the RSA, ECDSA and Ed25519 generators.
+type KeyPairSpec struct {
+	// RSA modulus size in bits. Ignored by the other key types.
+	// +kubebuilder:validation:Enum=2048;3072;4096
+	// +kubebuilder:default:=4096
+	// +kubebuilder:validation:Optional
+	Bits int `json:"bits,omitempty"`
+
+	// ECDSA curve. Ignored by the other key types.
+	// +kubebuilder:validation:Enum=P256;P384;P521
+	// +kubebuilder:default:=P256
+	// +kubebuilder:validation:Optional
+	Curve string `json:"curve,omitempty"`
+
+	// +kubebuilder:default:=PEM
+	// +kubebuilder:validation:Optional
+	Format KeyFormat `json:"format,omitempty"`
+}
+
+// ReplicationSpec selects the namespaces the Secret is copied to.
+// The namespaces listed in Namespaces and the namespaces matching NamespaceSelector are combined.
+// The namespace of the Password itself is always skipped.
+type ReplicationSpec struct {
+	// Names of the target namespaces.
+	// +kubebuilder:validation:Optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Label selector of the target namespaces.
+	// +kubebuilder:validation:Optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// PushSpec selects where in an external secret store the generated value is written.
+type PushSpec struct {
+	// Name of the SecretStore in the namespace of the Password.
+	// +kubebuilder:validation:Required
+	SecretStoreRef string `json:"secretStoreRef"`
+
+	// Path of the secret in the store, e.g. "apps/database".
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// ConfigMapKeySelector selects a key of a ConfigMap in the namespace of the Password.
+type ConfigMapKeySelector struct {
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// EncryptionSpec selects the public key the generated values are sealed with for export.
+type EncryptionSpec struct {
+	// PEM encoded PKIX public key ("PUBLIC KEY") of type X25519 or RSA.
+	// X25519 keys are used with ECDH and AES-256-GCM, RSA keys with RSA-OAEP and AES-256-GCM.
+	// +kubebuilder:validation:Required
+	PublicKeyRef ConfigMapKeySelector `json:"publicKeyRef"`
+}
+
+// RolloutKind is the kind of a workload restarted after the Secret changes.
+// +kubebuilder:validation:Enum=Deployment;StatefulSet
+type RolloutKind string
+
+const (
+	RolloutKindDeployment  RolloutKind = "Deployment"
+	RolloutKindStatefulSet RolloutKind = "StatefulSet"
+)
+
+// RolloutTarget selects workloads consuming the Secret by name or by label selector.
+// Exactly one of Name and Selector must be set.
+type RolloutTarget struct {
+	// +kubebuilder:validation:Required
+	Kind RolloutKind `json:"kind"`
+
+	// Name of the workload.
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+
+	// Label selector of the workloads.
+	// +kubebuilder:validation:Optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Namespace of the workloads. Defaults to the namespace of the Password.
+	// Other namespaces must be listed in spec.replicateTo.namespaces, so that a Password
+	// can only restart workloads in namespaces it already writes its Secret to.
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
 // PasswordSpec defines the desired state of Password
 type PasswordSpec struct {
 	// +kubebuilder:validation:Minimum=8
+	// +kubebuilder:validation:Maximum=128
 	// +kubebuilder:default:=20
 	// +kubebuilder:validation:Required
 	Length int `json:"length"`
@@ -53,20 +259,225 @@ type PasswordSpec struct {
 	// +kubebuilder:default:=false
 	// +kubebuilder:validation:Optional
 	DisallowRepeat bool `json:"disallowRepeat"`
+
+	// Symbols to draw from instead of the default set of go-password.
+	// Must only contain printable ASCII characters that are neither letters nor digits.
+	// +kubebuilder:validation:Optional
+	AllowedSymbols string `json:"allowedSymbols,omitempty"`
+
+	// Characters that never appear in the generated password, e.g. "0O1lI".
+	// +kubebuilder:validation:Optional
+	ExcludeCharacters string `json:"excludeCharacters,omitempty"`
+
+	// Minimum number of lower-case letters.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinLower int `json:"minLower,omitempty"`
+
+	// Minimum number of upper-case letters.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinUpper int `json:"minUpper,omitempty"`
+
+	// Name of a PasswordPolicy whose settings replace Length, Digit, Symbol, CaseSensitive,
+	// DisallowRepeat, AllowedSymbols, ExcludeCharacters, MinLower and MinUpper.
+	// +kubebuilder:validation:Optional
+	PolicyRef string `json:"policyRef,omitempty"`
+
+	// Number of previously generated values whose salted hashes are kept in
+	// the "<name>-history" Secret. A regenerated value never matches one of them.
+	// If that Secret exists and is not controlled by the Password, the Password fails
+	// instead of overwriting it. 0 disables the history.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default:=0
+	// +kubebuilder:validation:Optional
+	HistorySize int `json:"historySize,omitempty"`
+
+	// Namespaces the generated Secret is copied to and kept in sync with.
+	// The copies are deleted when the Password is deleted.
+	// +kubebuilder:validation:Optional
+	ReplicateTo *ReplicationSpec `json:"replicateTo,omitempty"`
+
+	// External secret store the generated value is pushed to.
+	// +kubebuilder:validation:Optional
+	PushTo *PushSpec `json:"pushTo,omitempty"`
+
+	// Seal the generated values with a public key and write them to the "<name>-sealed"
+	// ConfigMap, e.g. to commit them to git. The plaintext Secret is still created.
+	// +kubebuilder:validation:Optional
+	Encryption *EncryptionSpec `json:"encryption,omitempty"`
+
+	// Workloads restarted when the value of the Secret changes. The hash of the
+	// Secret is written to an annotation of their pod template.
+	// +kubebuilder:validation:Optional
+	RolloutTargets []RolloutTarget `json:"rolloutTargets,omitempty"`
+
+	// Generator selects how the Secret value is generated.
+	// Length, Digit, Symbol, CaseSensitive and DisallowRepeat only apply to the Password generator.
+	// +kubebuilder:default:=Password
+	// +kubebuilder:validation:Optional
+	Generator GeneratorType `json:"generator,omitempty"`
+
+	// Options for the Passphrase generator.
+	// +kubebuilder:validation:Optional
+	Passphrase *PassphraseSpec `json:"passphrase,omitempty"`
+
+	// Options for the Hex and Base64 generators.
+	// +kubebuilder:validation:Optional
+	Token *TokenSpec `json:"token,omitempty"`
+
+	// Options for the RSA, ECDSA and Ed25519 generators.
+	// +kubebuilder:validation:Optional
+	KeyPair *KeyPairSpec `json:"keyPair,omitempty"`
+
+	// ImportPolicy decides what happens when a Secret with the name of the Password
+	// already exists and is not owned by it.
+	// +kubebuilder:default:=Fail
+	// +kubebuilder:validation:Optional
+	ImportPolicy ImportPolicy `json:"importPolicy,omitempty"`
+
+	// RetainPolicy decides whether the Secret is deleted or kept when the Password is deleted.
+	// +kubebuilder:default:=Delete
+	// +kubebuilder:validation:Optional
+	RetainPolicy RetainPolicy `json:"retainPolicy,omitempty"`
+
+	// DeletionDelay postpones the deletion of the Secret after the Password is deleted,
+	// e.g. "24h". Setting retainPolicy to Retain during the delay keeps the Secret.
+	// Ignored when retainPolicy is Retain.
+	// +kubebuilder:validation:Optional
+	DeletionDelay *metav1.Duration `json:"deletionDelay,omitempty"`
+
+	// TTL of the generated value, e.g. "8h", counted from status.lastGeneratedTime
+	// (or from the creation of the Password if the value of an adopted Secret was kept).
+	// After it the Password is marked Expired and the Secret is handled according to spec.expirePolicy.
+	// +kubebuilder:validation:Optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// ExpirePolicy decides whether the Secret is deleted or regenerated after spec.ttl.
+	// +kubebuilder:default:=Delete
+	// +kubebuilder:validation:Optional
+	ExpirePolicy ExpirePolicy `json:"expirePolicy,omitempty"`
 }
 
-// PasswordStatus defines the observed state of Password
-type PasswordStatus struct {
-	// Information about if Password is in-sync.
-	State PasswordState `json:"state,omitempty"` // in-sync, failed
+// PasswordCharacterSets are the characters the Password generator draws from.
+// +kubebuilder:object:generate=false
+type PasswordCharacterSets struct {
+	Lower   string
+	Upper   string
+	Digits  string
+	Symbols string
+}
+
+// CharacterSets returns the character sets of the Password generator after
+// applying AllowedSymbols and ExcludeCharacters.
+func (s *PasswordSpec) CharacterSets() PasswordCharacterSets {
+	symbols := passwordGenerator.Symbols
+	if s.AllowedSymbols != "" {
+		symbols = s.AllowedSymbols
+	}
+	return PasswordCharacterSets{
+		Lower:   removeCharacters(passwordGenerator.LowerLetters, s.ExcludeCharacters),
+		Upper:   removeCharacters(passwordGenerator.UpperLetters, s.ExcludeCharacters),
+		Digits:  removeCharacters(passwordGenerator.Digits, s.ExcludeCharacters),
+		Symbols: removeCharacters(symbols, s.ExcludeCharacters),
+	}
+}
+
+// RolloutNamespace returns the namespace of the workloads selected by target.
+func (s *PasswordSpec) RolloutNamespace(passwordNamespace string, target RolloutTarget) string {
+	if target.Namespace == "" {
+		return passwordNamespace
+	}
+	return target.Namespace
+}
+
+// RolloutNamespaceAllowed reports whether a Password in passwordNamespace may restart workloads
+// in namespace: its own namespace and the namespaces listed in spec.replicateTo.namespaces.
+// Namespaces only selected by spec.replicateTo.namespaceSelector are not allowed, since
+// the labels of a namespace can be changed by its users.
+func (s *PasswordSpec) RolloutNamespaceAllowed(passwordNamespace, namespace string) bool {
+	if namespace == passwordNamespace {
+		return true
+	}
+	if s.ReplicateTo == nil {
+		return false
+	}
+	for _, ns := range s.ReplicateTo.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// removeCharacters returns chars without the characters in exclude and without duplicates.
+func removeCharacters(chars, exclude string) string {
+	var b strings.Builder
+	for _, c := range chars {
+		if strings.ContainsRune(exclude, c) || strings.ContainsRune(b.String(), c) {
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// ReplicaStatus is the sync state of the copy of the Secret in one namespace.
+type ReplicaStatus struct {
+	Namespace string `json:"namespace"`
+	// Information about if the copy is in-sync.
+	State PasswordState `json:"state"`
 	// Fail reason
 	Reason string `json:"reason,omitempty"`
 }
 
+// RolloutStatus is the last restart of a workload selected by spec.rolloutTargets.
+type RolloutStatus struct {
+	Kind      RolloutKind `json:"kind"`
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	// Hash of the UID and resourceVersion of the Secret the workload was last restarted with,
+	// or of the Secret when the workload was first selected. It never depends on the value.
+	// The workload is restarted when the hash of the Secret changes.
+	SecretHash string `json:"secretHash,omitempty"`
+	// Time the workload was last restarted by the controller.
+	RestartedAt *metav1.Time `json:"restartedAt,omitempty"`
+}
+
+// PasswordStatus defines the observed state of Password
+type PasswordStatus struct {
+	// Generation of the Password last processed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Reference to the Secret owned by the Password.
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// Time the value of the Secret was last generated.
+	LastGeneratedTime *metav1.Time `json:"lastGeneratedTime,omitempty"`
+	// Time the value of the Secret expires according to spec.ttl.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// Number of values currently kept in the password history.
+	HistoryDepth int `json:"historyDepth,omitempty"`
+	// Sync state of the copies made for spec.replicateTo, sorted by namespace.
+	Replicas []ReplicaStatus `json:"replicas,omitempty"`
+	// Reference to the ConfigMap holding the values sealed for spec.encryption.
+	SealedRef *corev1.LocalObjectReference `json:"sealedRef,omitempty"`
+	// Workloads selected by spec.rolloutTargets, sorted by kind, namespace and name.
+	Rollouts []RolloutStatus `json:"rollouts,omitempty"`
+	// resourceVersion of the Secret last pushed to spec.pushTo.
+	PushedSecretVersion string `json:"pushedSecretVersion,omitempty"`
+	// Conditions of the Password.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
-// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
-// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.reason`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.status.secretRef.name`
+// +kubebuilder:printcolumn:name="Last Generated",type=date,JSONPath=`.status.lastGeneratedTime`
+// +kubebuilder:printcolumn:name="Expires At",type=string,format=date-time,JSONPath=`.status.expiresAt`
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Password is the Schema for the passwords API
@@ -17,9 +17,16 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"reflect"
+	"unicode"
+
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
@@ -30,47 +37,315 @@ var passwordlog = logf.Log.WithName("password-resource")
 func (r *Password) SetupWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		// キャッシュを経由せずに読み込み、PasswordPolicyとNamespaceのinformerを起動しない
+		WithValidator(&PasswordValidator{Reader: mgr.GetAPIReader()}).
 		Complete()
 }
 
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+// ProtectAnnotation prevents a Password from being deleted while it is set to "true".
+const ProtectAnnotation = "secret.example.com/protect"
+
+// MaxPasswordLength is the upper bound of spec.length.
+const MaxPasswordLength = 128
+
+// spec.generatorごとのオプションのデフォルト値（CRDのデフォルト値と同じ）
+const (
+	defaultPassphraseWords     = 6
+	defaultPassphraseSeparator = "-"
+	defaultTokenBytes          = 32
+	defaultKeyPairBits         = 4096
+	defaultKeyPairCurve        = "P256"
+)
+
+// +kubebuilder:webhook:path=/mutate-secret-example-com-v1alpha1-password,mutating=true,failurePolicy=fail,sideEffects=None,groups=secret.example.com,resources=passwords,verbs=create;update,versions=v1alpha1,name=mpassword.kb.io,admissionReviewVersions=v1
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-// +kubebuilder:webhook:path=/validate-secret-example-com-v1alpha1-password,mutating=false,failurePolicy=fail,sideEffects=None,groups=secret.example.com,resources=passwords,verbs=create;update,versions=v1alpha1,name=vpassword.kb.io,admissionReviewVersions=v1
+var _ webhook.Defaulter = &Password{}
 
-var _ webhook.Validator = &Password{}
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Password) Default() {
+	passwordlog.Info("default", "name", r.Name)
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *Password) ValidateCreate() error {
+	if r.Spec.Generator == "" {
+		r.Spec.Generator = GeneratorPassword
+	}
+
+	// CRDのデフォルト値はオブジェクトが指定された場合にしか適用されないため、
+	// 選択されたGeneratorのオプションが省略された場合はここで補完する
+	switch r.Spec.Generator {
+	case GeneratorPassphrase:
+		if r.Spec.Passphrase == nil {
+			r.Spec.Passphrase = &PassphraseSpec{}
+		}
+		if r.Spec.Passphrase.Words == 0 {
+			r.Spec.Passphrase.Words = defaultPassphraseWords
+		}
+		if r.Spec.Passphrase.Separator == "" {
+			r.Spec.Passphrase.Separator = defaultPassphraseSeparator
+		}
+	case GeneratorHex, GeneratorBase64:
+		if r.Spec.Token == nil {
+			r.Spec.Token = &TokenSpec{}
+		}
+		if r.Spec.Token.Bytes == 0 {
+			r.Spec.Token.Bytes = defaultTokenBytes
+		}
+	case GeneratorRSA, GeneratorECDSA, GeneratorEd25519:
+		if r.Spec.KeyPair == nil {
+			r.Spec.KeyPair = &KeyPairSpec{}
+		}
+		if r.Spec.KeyPair.Bits == 0 {
+			r.Spec.KeyPair.Bits = defaultKeyPairBits
+		}
+		if r.Spec.KeyPair.Curve == "" {
+			r.Spec.KeyPair.Curve = defaultKeyPairCurve
+		}
+		if r.Spec.KeyPair.Format == "" {
+			r.Spec.KeyPair.Format = KeyFormatPEM
+		}
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-secret-example-com-v1alpha1-password,mutating=false,failurePolicy=fail,sideEffects=None,groups=secret.example.com,resources=passwords,verbs=create;update;delete,versions=v1alpha1,name=vpassword.kb.io,admissionReviewVersions=v1
+
+// PasswordValidator validates Passwords, including the bounds of the PasswordPolicies they are subject to.
+// +kubebuilder:object:generate=false
+type PasswordValidator struct {
+	// Reader looks up PasswordPolicies and Namespaces.
+	Reader client.Reader
+}
+
+var _ webhook.CustomValidator = &PasswordValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *PasswordValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*Password)
+	if !ok {
+		return fmt.Errorf("expected a Password but got a %T", obj)
+	}
 	passwordlog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return r.validatePassword()
+	return v.validatePassword(ctx, r, true)
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *Password) ValidateUpdate(old runtime.Object) error {
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *PasswordValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	r, ok := newObj.(*Password)
+	if !ok {
+		return fmt.Errorf("expected a Password but got a %T", newObj)
+	}
 	passwordlog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	return r.validatePassword()
+	// 削除中のPasswordはfinalizerを外すための更新を妨げないようにチェックしない
+	if !r.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	oldPassword, ok := oldObj.(*Password)
+	if !ok {
+		return fmt.Errorf("expected a Password but got a %T", oldObj)
+	}
+	if err := r.validateImmutableFields(oldPassword); err != nil {
+		return err
+	}
+	// PasswordPolicyが厳しくなった後でも、コントローラーによるメタデータの更新は妨げない
+	return v.validatePassword(ctx, r, !reflect.DeepEqual(r.Spec, oldPassword.Spec))
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *Password) ValidateDelete() error {
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *PasswordValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*Password)
+	if !ok {
+		return fmt.Errorf("expected a Password but got a %T", obj)
+	}
 	passwordlog.Info("validate delete", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object deletion.
+	if r.Annotations[ProtectAnnotation] == "true" {
+		return ErrPasswordProtected
+	}
 	return nil
 }
 
 // エラー定義
 var ErrSumOfDigitAndSymbolMustBeLessThanLength = errors.New("Number of digits and symbols must be less than total length")
+var ErrSumOfMinLowerAndMinUpperMustBeLessThanLetters = errors.New("Number of minimum lower and upper case letters must be less than number of letters")
+var ErrMinUpperRequiresUpperLetters = errors.New("minUpper requires upper case letters but caseSensitive disables them")
+var ErrAllowedSymbolsMustBeSymbols = errors.New("allowedSymbols must only contain printable ASCII characters that are neither letters nor digits")
+var ErrNoCharactersLeft = errors.New("no characters left after excluding excludeCharacters")
+var ErrLengthExceedsMaximum = fmt.Errorf("length must be less than or equal to %d", MaxPasswordLength)
+var ErrNotEnoughCharactersForDisallowRepeat = errors.New("not enough distinct characters to generate a password without repeating characters")
+var ErrGeneratorImmutable = errors.New("generator is immutable")
+var ErrKeyPairImmutable = errors.New("keyPair is immutable")
+var ErrRolloutTargetNameOrSelector = errors.New("rolloutTargets must specify exactly one of name and selector")
+var ErrRolloutTargetNamespace = errors.New("rolloutTargets may only select the namespace of the Password or a namespace in replicateTo.namespaces")
+var ErrPasswordProtected = fmt.Errorf("Password is protected by the %s annotation", ProtectAnnotation)
+var ErrWeakerThanPolicy = errors.New("Password is weaker than the PasswordPolicy")
+var ErrTTLMustBePositive = errors.New("ttl must be positive")
+
+// rolloutTargetsはnameとselectorのどちらか一方だけを指定する
+// Controllerの権限で他のnamespaceのワークロードを変更できないように、namespaceはPasswordと同じかreplicateTo.namespacesに限る
+func (r *Password) validateRolloutTargets() error {
+	for i, target := range r.Spec.RolloutTargets {
+		if (target.Name == "") == (target.Selector == nil) {
+			return fmt.Errorf("%w: rolloutTargets[%d]", ErrRolloutTargetNameOrSelector, i)
+		}
+		if namespace := r.Spec.RolloutNamespace(r.Namespace, target); !r.Spec.RolloutNamespaceAllowed(r.Namespace, namespace) {
+			return fmt.Errorf("%w: rolloutTargets[%d] selects namespace %s", ErrRolloutTargetNamespace, i, namespace)
+		}
+	}
+	return nil
+}
+
+// 生成済みのSecretの形式が変わらないように、generatorとkeyPairの変更を禁止
+// keyPairはデフォルト値が補完される前に作成されたPasswordのために、既存の値がある場合のみチェックする
+func (r *Password) validateImmutableFields(old *Password) error {
+	if generatorOrDefault(r.Spec.Generator) != generatorOrDefault(old.Spec.Generator) {
+		return ErrGeneratorImmutable
+	}
+	if old.Spec.KeyPair != nil && !reflect.DeepEqual(r.Spec.KeyPair, old.Spec.KeyPair) {
+		return ErrKeyPairImmutable
+	}
+	return nil
+}
+
+func generatorOrDefault(g GeneratorType) GeneratorType {
+	if g == "" {
+		return GeneratorPassword
+	}
+	return g
+}
+
+// validatePassword checks the spec of r. If checkPolicies is set, the settings of
+// spec.policyRef are applied first and the result is checked against the bounds of the
+// referenced PasswordPolicy and of the default PasswordPolicy of the namespace.
+func (v *PasswordValidator) validatePassword(ctx context.Context, r *Password, checkPolicies bool) error {
+	if err := r.validateRolloutTargets(); err != nil {
+		return err
+	}
+	if r.Spec.TTL != nil && r.Spec.TTL.Duration <= 0 {
+		return ErrTTLMustBePositive
+	}
+	// specが変わっていない場合は自身の設定だけをチェック（policyRefの設定は参照先で置き換えられるためチェックしない）
+	if !checkPolicies {
+		if r.Spec.PolicyRef != "" {
+			return nil
+		}
+		return validateGeneratorSettings(r.Spec)
+	}
+
+	spec := r.Spec
+	var policies []*PasswordPolicy
+	if r.Spec.PolicyRef != "" {
+		policy := &PasswordPolicy{}
+		if err := v.Reader.Get(ctx, client.ObjectKey{Name: r.Spec.PolicyRef}, policy); err != nil {
+			return fmt.Errorf("PasswordPolicy %s: %w", r.Spec.PolicyRef, err)
+		}
+		policy.Spec.Apply(&spec)
+		policies = append(policies, policy)
+	}
+	defaultPolicy, err := NamespaceDefaultPolicy(ctx, v.Reader, r.Namespace)
+	if err != nil {
+		return err
+	}
+	if defaultPolicy != nil {
+		policies = append(policies, defaultPolicy)
+	}
+
+	if err := validateGeneratorSettings(spec); err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		if err := policy.Spec.Check(spec); err != nil {
+			return fmt.Errorf("PasswordPolicy %s: %w", policy.Name, err)
+		}
+	}
+	return nil
+}
+
+// NamespaceDefaultPolicy returns the PasswordPolicy selected by the PolicyNamespaceLabel of
+// the namespace, or nil if the namespace is not labeled.
+func NamespaceDefaultPolicy(ctx context.Context, reader client.Reader, namespace string) (*PasswordPolicy, error) {
+	ns := &corev1.Namespace{}
+	if err := reader.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return nil, fmt.Errorf("namespace %s: %w", namespace, err)
+	}
+	name := ns.Labels[PolicyNamespaceLabel]
+	if name == "" {
+		return nil, nil
+	}
+	// ラベルで指定されたPasswordPolicyが存在しない場合も、最低限の基準を保証できないため拒否する
+	policy := &PasswordPolicy{}
+	if err := reader.Get(ctx, client.ObjectKey{Name: name}, policy); err != nil {
+		return nil, fmt.Errorf("default PasswordPolicy %s of namespace %s: %w", name, namespace, err)
+	}
+	return policy, nil
+}
 
 // PasswordのSpecでDigit + SymbolがLengthよりも長かった場合にエラーを返すように実装
-func (r *Password) validatePassword() error {
-	if r.Spec.Digit+r.Spec.Symbol > r.Spec.Length {
+// Length, Digit, SymbolはPassword Generatorでのみ使用されるため、それ以外のGeneratorではチェックしない
+func validateGeneratorSettings(spec PasswordSpec) error {
+	if spec.Generator != "" && spec.Generator != GeneratorPassword {
+		return nil
+	}
+	if spec.Length > MaxPasswordLength {
+		return ErrLengthExceedsMaximum
+	}
+	if spec.Digit+spec.Symbol > spec.Length {
 		return ErrSumOfDigitAndSymbolMustBeLessThanLength
 	}
+	return validateCharacterSets(spec)
+}
+
+// allowedSymbols, excludeCharacters, minLower, minUpperの組み合わせでパスワードが生成可能かをチェック
+func validateCharacterSets(spec PasswordSpec) error {
+	for _, c := range spec.AllowedSymbols {
+		if c < '!' || c > '~' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+			return ErrAllowedSymbolsMustBeSymbols
+		}
+	}
+
+	letters := spec.Length - spec.Digit - spec.Symbol
+	if spec.MinLower+spec.MinUpper > letters {
+		return ErrSumOfMinLowerAndMinUpperMustBeLessThanLetters
+	}
+	if spec.MinUpper > 0 && spec.CaseSensitive {
+		return ErrMinUpperRequiresUpperLetters
+	}
+
+	sets := spec.CharacterSets()
+	if spec.CaseSensitive {
+		sets.Upper = ""
+	}
+	switch {
+	case spec.MinLower > 0 && sets.Lower == "":
+		return fmt.Errorf("%w: lower case letters", ErrNoCharactersLeft)
+	case spec.MinUpper > 0 && sets.Upper == "":
+		return fmt.Errorf("%w: upper case letters", ErrNoCharactersLeft)
+	case letters > 0 && sets.Lower+sets.Upper == "":
+		return fmt.Errorf("%w: letters", ErrNoCharactersLeft)
+	case spec.Digit > 0 && sets.Digits == "":
+		return fmt.Errorf("%w: digits", ErrNoCharactersLeft)
+	case spec.Symbol > 0 && sets.Symbols == "":
+		return fmt.Errorf("%w: symbols", ErrNoCharactersLeft)
+	}
+	if spec.DisallowRepeat {
+		return validateDisallowRepeat(sets, letters, spec.Digit, spec.Symbol, spec.MinLower, spec.MinUpper)
+	}
+	return nil
+}
+
+// disallowRepeatの場合は同じ文字を2回使えないため、各文字セットに必要な数以上の文字があるかをチェック
+// （go-passwordは生成時にErrLettersExceedsAvailableなどのエラーを返す）
+func validateDisallowRepeat(sets PasswordCharacterSets, letters, digit, symbol, minLower, minUpper int) error {
+	switch {
+	case minLower > len(sets.Lower):
+		return fmt.Errorf("%w: lower case letters", ErrNotEnoughCharactersForDisallowRepeat)
+	case minUpper > len(sets.Upper):
+		return fmt.Errorf("%w: upper case letters", ErrNotEnoughCharactersForDisallowRepeat)
+	case letters > len(sets.Lower)+len(sets.Upper):
+		return fmt.Errorf("%w: letters", ErrNotEnoughCharactersForDisallowRepeat)
+	case digit > len(sets.Digits):
+		return fmt.Errorf("%w: digits", ErrNotEnoughCharactersForDisallowRepeat)
+	case symbol > len(sets.Symbols):
+		return fmt.Errorf("%w: symbols", ErrNotEnoughCharactersForDisallowRepeat)
+	}
 	return nil
 }
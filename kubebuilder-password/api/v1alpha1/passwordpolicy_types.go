@@ -0,0 +1,268 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"math"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PolicyNamespaceLabel selects the default PasswordPolicy of a namespace.
+// The Passwords of a namespace labeled with the name of a PasswordPolicy must satisfy its bounds.
+const PolicyNamespaceLabel = "secret.example.com/password-policy"
+
+// PasswordPolicySpec defines the desired state of PasswordPolicy
+type PasswordPolicySpec struct {
+	// Settings of the Password generator used by the Passwords referring to the policy
+	// with spec.policyRef. They replace the settings of the Password.
+
+	// +kubebuilder:validation:Minimum=8
+	// +kubebuilder:validation:Maximum=128
+	// +kubebuilder:default:=20
+	// +kubebuilder:validation:Optional
+	Length int `json:"length"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default:=10
+	// +kubebuilder:validation:Optional
+	Digit int `json:"digit"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default:=10
+	// +kubebuilder:validation:Optional
+	Symbol int `json:"symbol"`
+
+	// +kubebuilder:default:=false
+	// +kubebuilder:validation:Optional
+	CaseSensitive bool `json:"caseSensitive"`
+	// +kubebuilder:default:=false
+	// +kubebuilder:validation:Optional
+	DisallowRepeat bool `json:"disallowRepeat"`
+
+	// +kubebuilder:validation:Optional
+	AllowedSymbols string `json:"allowedSymbols,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	ExcludeCharacters string `json:"excludeCharacters,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinLower int `json:"minLower,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinUpper int `json:"minUpper,omitempty"`
+
+	// Bounds the Passwords referring to the policy, and the Passwords of the namespaces
+	// labeled with secret.example.com/password-policy=<name>, must satisfy. 0 means unbounded.
+
+	// Minimum of spec.length.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinLength int `json:"minLength,omitempty"`
+
+	// Maximum of spec.length.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=128
+	// +kubebuilder:validation:Optional
+	MaxLength int `json:"maxLength,omitempty"`
+
+	// Minimum of spec.digit.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinDigit int `json:"minDigit,omitempty"`
+
+	// Minimum of spec.symbol.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinSymbol int `json:"minSymbol,omitempty"`
+
+	// Minimum of spec.minLower.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinLowerBound int `json:"minLowerBound,omitempty"`
+
+	// Minimum of spec.minUpper.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinUpperBound int `json:"minUpperBound,omitempty"`
+
+	// Minimum estimated entropy of the generated value in bits, which also bounds the
+	// character sets left by caseSensitive and excludeCharacters. Key pairs are not bounded.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinEntropyBits int `json:"minEntropyBits,omitempty"`
+
+	// Generators the Passwords may use. Only the Password generator is allowed if empty.
+	// +kubebuilder:validation:Optional
+	AllowedGenerators []GeneratorType `json:"allowedGenerators,omitempty"`
+}
+
+// Apply replaces the settings of the Password generator in spec with the settings of the policy.
+func (p *PasswordPolicySpec) Apply(spec *PasswordSpec) {
+	spec.Length = p.Length
+	spec.Digit = p.Digit
+	spec.Symbol = p.Symbol
+	spec.CaseSensitive = p.CaseSensitive
+	spec.DisallowRepeat = p.DisallowRepeat
+	spec.AllowedSymbols = p.AllowedSymbols
+	spec.ExcludeCharacters = p.ExcludeCharacters
+	spec.MinLower = p.MinLower
+	spec.MinUpper = p.MinUpper
+}
+
+// Check returns an error wrapping ErrWeakerThanPolicy if spec does not satisfy the bounds of the policy.
+// The counts are only bounded for the Password generator, the entropy for every generator but key pairs.
+func (p *PasswordPolicySpec) Check(spec PasswordSpec) error {
+	generator := generatorOrDefault(spec.Generator)
+	if !p.AllowsGenerator(generator) {
+		return fmt.Errorf("%w: generator %s is not allowed", ErrWeakerThanPolicy, generator)
+	}
+	if generator == GeneratorPassword {
+		switch {
+		case spec.Length < p.MinLength:
+			return fmt.Errorf("%w: length must be at least %d", ErrWeakerThanPolicy, p.MinLength)
+		case p.MaxLength > 0 && spec.Length > p.MaxLength:
+			return fmt.Errorf("%w: length must be at most %d", ErrWeakerThanPolicy, p.MaxLength)
+		case spec.Digit < p.MinDigit:
+			return fmt.Errorf("%w: digit must be at least %d", ErrWeakerThanPolicy, p.MinDigit)
+		case spec.Symbol < p.MinSymbol:
+			return fmt.Errorf("%w: symbol must be at least %d", ErrWeakerThanPolicy, p.MinSymbol)
+		case spec.MinLower < p.MinLowerBound:
+			return fmt.Errorf("%w: minLower must be at least %d", ErrWeakerThanPolicy, p.MinLowerBound)
+		case spec.MinUpper < p.MinUpperBound:
+			return fmt.Errorf("%w: minUpper must be at least %d", ErrWeakerThanPolicy, p.MinUpperBound)
+		}
+	}
+	if bits, ok := entropyBits(spec); ok && bits < float64(p.MinEntropyBits) {
+		return fmt.Errorf("%w: entropy must be at least %d bits", ErrWeakerThanPolicy, p.MinEntropyBits)
+	}
+	return nil
+}
+
+// AllowsGenerator reports whether the Passwords bounded by the policy may use generator.
+func (p *PasswordPolicySpec) AllowsGenerator(generator GeneratorType) bool {
+	if len(p.AllowedGenerators) == 0 {
+		return generator == GeneratorPassword
+	}
+	for _, g := range p.AllowedGenerators {
+		if g == generator {
+			return true
+		}
+	}
+	return false
+}
+
+// PassphraseWordlistSize is the number of words the Passphrase generator draws from.
+const PassphraseWordlistSize = 1177
+
+// entropyBits estimates the entropy of the values generated with spec in bits.
+// It returns false for the key pair generators.
+func entropyBits(spec PasswordSpec) (float64, bool) {
+	switch generatorOrDefault(spec.Generator) {
+	case GeneratorPassword:
+		// 文字種ごとの文字の選び方と、文字種の並び方の組み合わせ
+		sets := spec.CharacterSets()
+		letterSet := sets.Lower
+		if !spec.CaseSensitive {
+			letterSet += sets.Upper
+		}
+		letters := spec.Length - spec.Digit - spec.Symbol
+		repeat := !spec.DisallowRepeat
+		bits := drawBits(len(letterSet), letters, repeat) +
+			drawBits(len(sets.Digits), spec.Digit, repeat) +
+			drawBits(len(sets.Symbols), spec.Symbol, repeat)
+		return bits + log2Factorial(spec.Length) - log2Factorial(letters) - log2Factorial(spec.Digit) - log2Factorial(spec.Symbol), true
+	case GeneratorPassphrase:
+		words := defaultPassphraseWords
+		if spec.Passphrase != nil && spec.Passphrase.Words > 0 {
+			words = spec.Passphrase.Words
+		}
+		return float64(words) * math.Log2(PassphraseWordlistSize), true
+	case GeneratorHex, GeneratorBase64:
+		bytes := defaultTokenBytes
+		if spec.Token != nil && spec.Token.Bytes > 0 {
+			bytes = spec.Token.Bytes
+		}
+		return float64(8 * bytes), true
+	case GeneratorUUID:
+		// version 4のUUIDは128ビット中122ビットがランダム
+		return 122, true
+	}
+	return 0, false
+}
+
+// drawBits returns the entropy of drawing n characters from a set of size characters.
+func drawBits(size, n int, repeat bool) float64 {
+	var bits float64
+	for i := 0; i < n; i++ {
+		available := size
+		if !repeat {
+			available -= i
+		}
+		if available <= 1 {
+			break
+		}
+		bits += math.Log2(float64(available))
+	}
+	return bits
+}
+
+func log2Factorial(n int) float64 {
+	if n <= 1 {
+		return 0
+	}
+	lg, _ := math.Lgamma(float64(n + 1))
+	return lg / math.Ln2
+}
+
+// PasswordPolicyStatus defines the observed state of PasswordPolicy
+type PasswordPolicyStatus struct {
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Length",type=integer,JSONPath=`.spec.length`
+// +kubebuilder:printcolumn:name="Min Length",type=integer,JSONPath=`.spec.minLength`
+// +kubebuilder:printcolumn:name="Max Length",type=integer,JSONPath=`.spec.maxLength`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PasswordPolicy is the Schema for the passwordpolicies API.
+// It holds the Password generator settings shared by many Passwords and the minimums they must satisfy.
+type PasswordPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PasswordPolicySpec   `json:"spec,omitempty"`
+	Status PasswordPolicyStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PasswordPolicyList contains a list of PasswordPolicy
+type PasswordPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PasswordPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PasswordPolicy{}, &PasswordPolicyList{})
+}
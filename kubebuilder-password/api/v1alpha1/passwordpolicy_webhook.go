@@ -0,0 +1,85 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var passwordpolicylog = logf.Log.WithName("passwordpolicy-resource")
+
+func (r *PasswordPolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-secret-example-com-v1alpha1-passwordpolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=secret.example.com,resources=passwordpolicies,verbs=create;update,versions=v1alpha1,name=vpasswordpolicy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &PasswordPolicy{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *PasswordPolicy) ValidateCreate() error {
+	passwordpolicylog.Info("validate create", "name", r.Name)
+
+	return r.Spec.Validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *PasswordPolicy) ValidateUpdate(old runtime.Object) error {
+	passwordpolicylog.Info("validate update", "name", r.Name)
+
+	// 変更後の設定も自身の基準を満たす必要がある（基準だけを厳しくすることはできない）
+	return r.Spec.Validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *PasswordPolicy) ValidateDelete() error {
+	passwordpolicylog.Info("validate delete", "name", r.Name)
+
+	return nil
+}
+
+var ErrMinLengthExceedsMaxLength = errors.New("minLength must be less than or equal to maxLength")
+
+// Validate checks that the generator settings of the policy can generate a password and
+// satisfy the bounds of the policy, so that the Passwords referring to it are never weaker than its bounds.
+func (p *PasswordPolicySpec) Validate() error {
+	if p.MaxLength > 0 && p.MinLength > p.MaxLength {
+		return ErrMinLengthExceedsMaxLength
+	}
+	spec := PasswordSpec{Generator: GeneratorPassword}
+	p.Apply(&spec)
+	if err := validateGeneratorSettings(spec); err != nil {
+		return err
+	}
+	// Password Generatorを許可しない場合、設定は使われないため基準と比較しない
+	if !p.AllowsGenerator(GeneratorPassword) {
+		return nil
+	}
+	if err := p.Check(spec); err != nil {
+		return fmt.Errorf("settings of the PasswordPolicy: %w", err)
+	}
+	return nil
+}
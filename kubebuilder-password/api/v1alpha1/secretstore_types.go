@@ -0,0 +1,94 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretKeySelector selects a key of a Secret in the namespace of the referring object.
+type SecretKeySelector struct {
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// VaultProvider configures a Vault-compatible KV version 2 secrets engine.
+// +kubebuilder:validation:XValidation:rule="self.server.startsWith('https://') || (has(self.allowInsecureHTTP) && self.allowInsecureHTTP)",message="server must use https unless allowInsecureHTTP is set"
+type VaultProvider struct {
+	// Address of the Vault server, e.g. https://vault.example.com:8200
+	// http:// is only accepted with AllowInsecureHTTP, since the token is sent with every request.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +kubebuilder:validation:Required
+	Server string `json:"server"`
+
+	// Allows an http:// Server, sending the token in plaintext. Only meant for development.
+	// +kubebuilder:validation:Optional
+	AllowInsecureHTTP bool `json:"allowInsecureHTTP,omitempty"`
+
+	// Mount path of the KV version 2 secrets engine.
+	// +kubebuilder:default:=secret
+	// +kubebuilder:validation:Optional
+	Path string `json:"path,omitempty"`
+
+	// Vault Enterprise namespace.
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Secret key holding the Vault token.
+	// +kubebuilder:validation:Required
+	TokenSecretRef SecretKeySelector `json:"tokenSecretRef"`
+}
+
+// SecretStoreSpec defines the desired state of SecretStore
+type SecretStoreSpec struct {
+	// +kubebuilder:validation:Required
+	Vault *VaultProvider `json:"vault"`
+}
+
+// SecretStoreStatus defines the observed state of SecretStore
+type SecretStoreStatus struct {
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.spec.vault.server`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SecretStore is the Schema for the secretstores API.
+// It describes an external secret store that Passwords push their value to.
+type SecretStore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SecretStoreSpec   `json:"spec,omitempty"`
+	Status SecretStoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecretStoreList contains a list of SecretStore
+type SecretStoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecretStore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecretStore{}, &SecretStoreList{})
+}
@@ -29,7 +29,9 @@ import (
 	. "github.com/onsi/gomega"
 
 	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
 	//+kubebuilder:scaffold:imports
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -81,6 +83,9 @@ var _ = BeforeSuite(func() {
 	err = admissionv1.AddToScheme(scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = corev1.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
@@ -102,6 +107,9 @@ var _ = BeforeSuite(func() {
 	err = (&Password{}).SetupWebhookWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = (&PasswordPolicy{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:webhook
 
 	go func() {
@@ -130,3 +138,354 @@ var _ = AfterSuite(func() {
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
+
+func newTestPassword(name string, spec PasswordSpec) *Password {
+	return &Password{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       spec,
+	}
+}
+
+var _ = Describe("Password webhook", func() {
+	Context("defaulting", func() {
+		It("should default the generator and its options", func() {
+			password := newTestPassword("default-passphrase", PasswordSpec{Length: 20, Generator: GeneratorPassphrase})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+
+			Expect(password.Spec.Passphrase).NotTo(BeNil())
+			Expect(password.Spec.Passphrase.Words).To(Equal(defaultPassphraseWords))
+			Expect(password.Spec.Passphrase.Separator).To(Equal(defaultPassphraseSeparator))
+		})
+
+		It("should default the keypair options", func() {
+			password := newTestPassword("default-keypair", PasswordSpec{Length: 20, Generator: GeneratorRSA})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+
+			Expect(password.Spec.KeyPair).To(Equal(&KeyPairSpec{Bits: defaultKeyPairBits, Curve: defaultKeyPairCurve, Format: KeyFormatPEM}))
+		})
+	})
+
+	Context("validation on create", func() {
+		It("should accept a valid Password", func() {
+			password := newTestPassword("valid", PasswordSpec{Length: 20, Digit: 5, Symbol: 5})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+			Expect(password.Spec.Generator).To(Equal(GeneratorPassword))
+		})
+
+		It("should reject digits and symbols longer than length", func() {
+			password := newTestPassword("too-many-digits", PasswordSpec{Length: 10, Digit: 6, Symbol: 6})
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrSumOfDigitAndSymbolMustBeLessThanLength.Error()))
+		})
+
+		It("should reject a length above the maximum", func() {
+			password := newTestPassword("too-long", PasswordSpec{Length: MaxPasswordLength + 1})
+			Expect(k8sClient.Create(ctx, password)).NotTo(Succeed())
+		})
+
+		It("should reject disallowRepeat without enough distinct digits", func() {
+			password := newTestPassword("repeat-digits", PasswordSpec{Length: 20, Digit: 8, DisallowRepeat: true, ExcludeCharacters: "0123"})
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrNotEnoughCharactersForDisallowRepeat.Error()))
+		})
+
+		It("should reject disallowRepeat without enough distinct letters", func() {
+			password := newTestPassword("repeat-letters", PasswordSpec{Length: 40, CaseSensitive: true, DisallowRepeat: true})
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrNotEnoughCharactersForDisallowRepeat.Error()))
+		})
+
+		It("should reject a rollout target with both name and selector", func() {
+			password := newTestPassword("rollout-target", PasswordSpec{Length: 20, RolloutTargets: []RolloutTarget{{
+				Kind:     RolloutKindDeployment,
+				Name:     "app",
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+			}}})
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrRolloutTargetNameOrSelector.Error()))
+		})
+
+		It("should reject a rollout target in a foreign namespace", func() {
+			password := newTestPassword("rollout-foreign", PasswordSpec{Length: 20, RolloutTargets: []RolloutTarget{{
+				Kind:      RolloutKindDeployment,
+				Name:      "app",
+				Namespace: "kube-system",
+			}}})
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrRolloutTargetNamespace.Error()))
+		})
+
+		It("should accept a rollout target in a namespace the Secret is replicated to", func() {
+			password := newTestPassword("rollout-replica", PasswordSpec{
+				Length:      20,
+				ReplicateTo: &ReplicationSpec{Namespaces: []string{"app"}},
+				RolloutTargets: []RolloutTarget{{
+					Kind:      RolloutKindDeployment,
+					Name:      "app",
+					Namespace: "app",
+				}},
+			})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+		})
+
+		It("should accept disallowRepeat with enough distinct characters", func() {
+			password := newTestPassword("repeat-ok", PasswordSpec{Length: 20, Digit: 5, Symbol: 5, DisallowRepeat: true})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+		})
+
+		It("should reject allowedSymbols containing letters, digits or non-printable characters", func() {
+			for _, symbols := range []string{"!a", "!1", "! "} {
+				password := newTestPassword("allowed-symbols", PasswordSpec{Length: 20, Digit: 5, Symbol: 5, AllowedSymbols: symbols})
+				err := k8sClient.Create(ctx, password)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(ErrAllowedSymbolsMustBeSymbols.Error()))
+			}
+		})
+
+		It("should accept allowedSymbols at the ends of the printable ASCII range", func() {
+			password := newTestPassword("allowed-symbols-ok", PasswordSpec{Length: 20, Digit: 5, Symbol: 5, AllowedSymbols: "!~"})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+		})
+
+		It("should reject minLower and minUpper longer than the letters", func() {
+			password := newTestPassword("min-letters", PasswordSpec{Length: 20, Digit: 5, Symbol: 5, MinLower: 6, MinUpper: 5})
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrSumOfMinLowerAndMinUpperMustBeLessThanLetters.Error()))
+		})
+
+		It("should accept minLower and minUpper as long as the letters", func() {
+			password := newTestPassword("min-letters-ok", PasswordSpec{Length: 20, Digit: 5, Symbol: 5, MinLower: 5, MinUpper: 5})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+		})
+
+		It("should reject minUpper when caseSensitive disables upper case letters", func() {
+			password := newTestPassword("min-upper", PasswordSpec{Length: 20, Digit: 5, Symbol: 5, CaseSensitive: true, MinUpper: 1})
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrMinUpperRequiresUpperLetters.Error()))
+		})
+
+		It("should accept minLower when caseSensitive disables upper case letters", func() {
+			password := newTestPassword("min-upper-ok", PasswordSpec{Length: 20, Digit: 5, Symbol: 5, CaseSensitive: true, MinLower: 10})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+		})
+
+		It("should reject excludeCharacters leaving no digits", func() {
+			password := newTestPassword("no-digits", PasswordSpec{Length: 20, Digit: 5, Symbol: 5, ExcludeCharacters: "0123456789"})
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrNoCharactersLeft.Error()))
+		})
+
+		It("should accept excludeCharacters leaving a single digit", func() {
+			password := newTestPassword("one-digit", PasswordSpec{Length: 20, Digit: 5, Symbol: 5, ExcludeCharacters: "012345678"})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+		})
+	})
+
+	Context("validation on update", func() {
+		It("should reject changing the generator", func() {
+			password := newTestPassword("immutable-generator", PasswordSpec{Length: 20, Generator: GeneratorHex})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+
+			password.Spec.Generator = GeneratorBase64
+			err := k8sClient.Update(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrGeneratorImmutable.Error()))
+		})
+
+		It("should reject changing the keypair options", func() {
+			password := newTestPassword("immutable-keypair", PasswordSpec{Length: 20, Generator: GeneratorECDSA})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+
+			password.Spec.KeyPair.Curve = "P384"
+			err := k8sClient.Update(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrKeyPairImmutable.Error()))
+		})
+
+		It("should accept changing the password options", func() {
+			password := newTestPassword("mutable-length", PasswordSpec{Length: 20})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+
+			password.Spec.Length = 30
+			Expect(k8sClient.Update(ctx, password)).To(Succeed())
+		})
+	})
+
+	Context("validation on delete", func() {
+		It("should reject deleting a protected Password until the annotation is removed", func() {
+			password := newTestPassword("protected", PasswordSpec{Length: 20})
+			password.Annotations = map[string]string{ProtectAnnotation: "true"}
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			err := k8sClient.Delete(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ProtectAnnotation))
+
+			delete(password.Annotations, ProtectAnnotation)
+			Expect(k8sClient.Update(ctx, password)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, password)).To(Succeed())
+		})
+	})
+
+	Context("PasswordPolicy", func() {
+		BeforeEach(func() {
+			policy := &PasswordPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "strict"},
+				Spec:       PasswordPolicySpec{Length: 32, Digit: 8, Symbol: 8, MinLength: 24, MinDigit: 4, MinSymbol: 4},
+			}
+			Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, policy)
+
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "policy-test",
+				Labels: map[string]string{PolicyNamespaceLabel: "strict"},
+			}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespace))).To(Succeed())
+		})
+
+		It("should reject a Password weaker than the default policy of the namespace", func() {
+			password := newTestPassword("weak", PasswordSpec{Length: 20, Digit: 5, Symbol: 5})
+			password.Namespace = "policy-test"
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrWeakerThanPolicy.Error()))
+		})
+
+		It("should accept a Password referring to the policy", func() {
+			password := newTestPassword("with-policy", PasswordSpec{Length: 20, PolicyRef: "strict"})
+			password.Namespace = "policy-test"
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+		})
+
+		It("should reject a PasswordPolicy whose settings are weaker than its bounds", func() {
+			policy := &PasswordPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "inconsistent"},
+				Spec:       PasswordPolicySpec{Length: 8, MinLength: 32},
+			}
+			err := k8sClient.Create(ctx, policy)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrWeakerThanPolicy.Error()))
+		})
+
+		It("should reject weakening the settings of a PasswordPolicy below its bounds", func() {
+			policy := &PasswordPolicy{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "strict"}, policy)).To(Succeed())
+			policy.Spec.Digit = 2
+			err := k8sClient.Update(ctx, policy)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrWeakerThanPolicy.Error()))
+		})
+
+		It("should reject a Password referring to a missing policy", func() {
+			password := newTestPassword("missing-policy", PasswordSpec{Length: 20, PolicyRef: "missing"})
+			Expect(k8sClient.Create(ctx, password)).NotTo(Succeed())
+		})
+
+		It("should not check the policy when only the metadata changes", func() {
+			password := newTestPassword("tightened", PasswordSpec{Length: 30, Digit: 5, Symbol: 5})
+			password.Namespace = "policy-test"
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+
+			policy := &PasswordPolicy{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "strict"}, policy)).To(Succeed())
+			policy.Spec.Length = 40
+			policy.Spec.MinLength = 40
+			Expect(k8sClient.Update(ctx, policy)).To(Succeed())
+
+			password.Labels = map[string]string{"team": "a"}
+			Expect(k8sClient.Update(ctx, password)).To(Succeed())
+
+			password.Spec.Length = 35
+			err := k8sClient.Update(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrWeakerThanPolicy.Error()))
+		})
+	})
+
+	// generator、文字セット、minLower/minUpperでPasswordPolicyの基準を回避できないことをテスト
+	Context("PasswordPolicy bounding generators and character sets", func() {
+		BeforeEach(func() {
+			policy := &PasswordPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "entropy"},
+				Spec: PasswordPolicySpec{
+					Length: 24, Digit: 4, Symbol: 4, MinLower: 2, MinUpper: 2,
+					MinLowerBound: 1, MinUpperBound: 1, MinEntropyBits: 110,
+					AllowedGenerators: []GeneratorType{GeneratorPassword, GeneratorHex},
+				},
+			}
+			Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, policy)
+
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "entropy-test",
+				Labels: map[string]string{PolicyNamespaceLabel: "entropy"},
+			}}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, namespace))).To(Succeed())
+		})
+
+		expectWeaker := func(spec PasswordSpec, message string) {
+			password := newTestPassword("bypass", spec)
+			password.Namespace = "entropy-test"
+			err := k8sClient.Create(ctx, password)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(ErrWeakerThanPolicy.Error()))
+			Expect(err.Error()).To(ContainSubstring(message))
+		}
+		expectAccepted := func(name string, spec PasswordSpec) {
+			password := newTestPassword(name, spec)
+			password.Namespace = "entropy-test"
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, password)
+		}
+
+		It("should reject a generator the policy does not allow", func() {
+			expectWeaker(PasswordSpec{Generator: GeneratorPassphrase, Passphrase: &PassphraseSpec{Words: 3}}, "generator Passphrase is not allowed")
+		})
+
+		It("should bound the entropy of the other generators", func() {
+			expectWeaker(PasswordSpec{Generator: GeneratorHex, Token: &TokenSpec{Bytes: 8}}, "entropy")
+			expectAccepted("hex", PasswordSpec{Generator: GeneratorHex, Token: &TokenSpec{Bytes: 16}})
+		})
+
+		It("should bound the entropy of the characters left by excludeCharacters", func() {
+			expectWeaker(PasswordSpec{
+				Length: 20, Digit: 2, Symbol: 2, MinLower: 1, MinUpper: 1,
+				ExcludeCharacters: "bcdefghijklmnopqrstuvwxyzBCDEFGHIJKLMNOPQRSTUVWXYZ",
+			}, "entropy")
+		})
+
+		It("should reject disabling upper case letters with caseSensitive", func() {
+			expectWeaker(PasswordSpec{Length: 20, Digit: 2, Symbol: 2, MinLower: 1, CaseSensitive: true}, "minUpper must be at least 1")
+		})
+
+		It("should reject fewer lower case letters than the bound", func() {
+			expectWeaker(PasswordSpec{Length: 20, Digit: 2, Symbol: 2, MinUpper: 1}, "minLower must be at least 1")
+		})
+
+		It("should accept a Password satisfying every bound", func() {
+			expectAccepted("bounded", PasswordSpec{Length: 20, Digit: 2, Symbol: 2, MinLower: 1, MinUpper: 1})
+		})
+	})
+})
@@ -18,6 +18,7 @@ package main
 
 import (
 	"flag"
+	"io"
 	"os"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -32,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+	"example.com/password-operator/internal/audit"
 	"example.com/password-operator/internal/controller"
 	//+kubebuilder:scaffold:imports
 )
@@ -52,11 +54,15 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var auditLog string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&auditLog, "audit-log", "",
+		"Write an audit record of every generated credential as JSON lines to this file, or to stdout if \"-\". "+
+			"Disabled if empty.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -89,31 +95,57 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controller.PasswordReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	passwordReconciler := &controller.PasswordReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("password-controller"),
+	}
+	// os.Exitはdeferを実行しないため、監査ログはexitで終了前に明示的に閉じる
+	var auditCloser io.Closer
+	exit := func(code int) {
+		if auditCloser != nil {
+			if err := auditCloser.Close(); err != nil {
+				setupLog.Error(err, "unable to close audit log", "path", auditLog)
+			}
+		}
+		os.Exit(code)
+	}
+	if auditLog != "" {
+		sink, closer, err := audit.Open(auditLog)
+		if err != nil {
+			setupLog.Error(err, "unable to open audit log", "path", auditLog)
+			os.Exit(1)
+		}
+		auditCloser = closer
+		passwordReconciler.Audit = sink
+	}
+	if err = passwordReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Password")
-		os.Exit(1)
+		exit(1)
 	}
 	if err = (&secretv1alpha1.Password{}).SetupWebhookWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "Password")
-		os.Exit(1)
+		exit(1)
+	}
+	if err = (&secretv1alpha1.PasswordPolicy{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "PasswordPolicy")
+		exit(1)
 	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
-		os.Exit(1)
+		exit(1)
 	}
 	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
-		os.Exit(1)
+		exit(1)
 	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
-		os.Exit(1)
+		exit(1)
 	}
+	exit(0)
 }
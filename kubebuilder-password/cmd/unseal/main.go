@@ -0,0 +1,115 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command unseal decrypts the values of a sealed ConfigMap ("<name>-sealed") written by the
+// operator for a Password with spec.encryption.
+//
+//	kubectl get configmap <name>-sealed -o json | unseal -key sealing.key -name password
+//
+// Without -name every value is printed as a JSON object of keys to decrypted values.
+package main
+
+import (
+	"crypto"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"example.com/password-operator/pkg/seal"
+)
+
+func main() {
+	var keyFile, inputFile, name string
+	flag.StringVar(&keyFile, "key", "", "The PEM encoded private key (PKCS #8 or PKCS #1) the values were sealed for.")
+	flag.StringVar(&inputFile, "f", "-", "The sealed ConfigMap as JSON, or - for stdin.")
+	flag.StringVar(&name, "name", "", "The key of the value to decrypt. All values are decrypted if empty.")
+	flag.Parse()
+
+	if err := run(keyFile, inputFile, name, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "unseal:", err)
+		os.Exit(1)
+	}
+}
+
+func run(keyFile, inputFile, name string, out io.Writer) error {
+	if keyFile == "" {
+		return fmt.Errorf("-key is required")
+	}
+	keyData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	privateKey, err := seal.ParsePrivateKey(keyData)
+	if err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	var input []byte
+	if inputFile == "-" {
+		input, err = io.ReadAll(os.Stdin)
+	} else {
+		input, err = os.ReadFile(inputFile)
+	}
+	if err != nil {
+		return err
+	}
+	var configMap corev1.ConfigMap
+	if err := json.Unmarshal(input, &configMap); err != nil {
+		return fmt.Errorf("failed to parse ConfigMap: %w", err)
+	}
+
+	if name != "" {
+		value, ok := configMap.Data[name]
+		if !ok {
+			return fmt.Errorf("ConfigMap %s has no key %q", configMap.Name, name)
+		}
+		plaintext, err := open(value, privateKey, name)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(plaintext)
+		return err
+	}
+
+	values := make(map[string]string, len(configMap.Data))
+	for k, v := range configMap.Data {
+		plaintext, err := open(v, privateKey, k)
+		if err != nil {
+			return err
+		}
+		values[k] = string(plaintext)
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(values)
+}
+
+// open decrypts the sealed value of key, which is the associated data of its Envelope.
+func open(value string, privateKey crypto.PrivateKey, key string) ([]byte, error) {
+	envelope, err := seal.Unmarshal([]byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	plaintext, err := seal.Open(envelope, privateKey, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records when the credentials of Passwords are generated.
+// Records never contain the generated values.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Record is one audit record.
+type Record struct {
+	Time time.Time `json:"time"`
+	// Event is the reason of the Kubernetes Event recorded together with the record, e.g. Created, Rotated, Failed or RolledOut.
+	Event       string    `json:"event"`
+	Namespace   string    `json:"namespace"`
+	Name        string    `json:"name"`
+	UID         types.UID `json:"uid"`
+	Generation  int64     `json:"generation"`
+	ReconcileID types.UID `json:"reconcileID,omitempty"`
+	// ResourceVersion of the Secret after the event, empty if there is no Secret.
+	SecretResourceVersion string `json:"secretResourceVersion,omitempty"`
+	Reason                string `json:"reason"`
+	Message               string `json:"message,omitempty"`
+}
+
+// Sink stores audit records.
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+// JSONSink writes every record as one line of JSON.
+type JSONSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+var _ Sink = &JSONSink{}
+
+// NewJSONSink returns a Sink writing JSON lines to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{enc: json.NewEncoder(w)}
+}
+
+// Write implements Sink.
+func (s *JSONSink) Write(_ context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(record)
+}
+
+// Open returns a JSONSink for path: "-" writes to stdout, anything else is a file
+// the records are appended to. The returned io.Closer closes the file.
+func Open(path string) (*JSONSink, io.Closer, error) {
+	if path == "-" {
+		return NewJSONSink(os.Stdout), io.NopCloser(nil), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewJSONSink(f), f, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSONSink", func() {
+	record := Record{
+		Time:                  time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Event:                 "Created",
+		Namespace:             "default",
+		Name:                  "db",
+		UID:                   "uid",
+		Generation:            2,
+		SecretResourceVersion: "42",
+		Reason:                "Created",
+	}
+
+	It("should write one JSON object per line", func() {
+		var buf bytes.Buffer
+		sink := NewJSONSink(&buf)
+		Expect(sink.Write(context.Background(), record)).To(Succeed())
+		Expect(sink.Write(context.Background(), record)).To(Succeed())
+
+		scanner := bufio.NewScanner(&buf)
+		lines := 0
+		for scanner.Scan() {
+			var decoded Record
+			Expect(json.Unmarshal(scanner.Bytes(), &decoded)).To(Succeed())
+			Expect(decoded).To(Equal(record))
+			lines++
+		}
+		Expect(lines).To(Equal(2))
+	})
+
+	It("should append to a file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "audit.log")
+		for i := 0; i < 2; i++ {
+			sink, closer, err := Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sink.Write(context.Background(), record)).To(Succeed())
+			Expect(closer.Close()).To(Succeed())
+		}
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Count(data, []byte("\n"))).To(Equal(2))
+	})
+})
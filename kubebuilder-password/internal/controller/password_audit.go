@@ -0,0 +1,69 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+	"example.com/password-operator/internal/audit"
+)
+
+// Reasons of the events recorded when the value of a Secret changes or a reconcile fails,
+// when rollout targets are restarted and when the Secret is kept after the Password is deleted.
+const (
+	eventCreated         = "Created"
+	eventRotated         = "Rotated"
+	eventAdopted         = "Adopted"
+	eventFailed          = "Failed"
+	eventRolledOut       = "RolledOut"
+	eventRetained        = "Retained"
+	eventDeletionDelayed = "DeletionDelayed"
+)
+
+// recordEvent records a Kubernetes Event on password and writes it to the audit sink if one is configured.
+// secret is the Secret after the event, or nil if there is none. message must never contain the generated value.
+func (r *PasswordReconciler) recordEvent(ctx context.Context, password *secretv1alpha1.Password, secret *corev1.Secret, eventType, event, reason, message string) {
+	r.Recorder.Event(password, eventType, event, message)
+	if r.Audit == nil {
+		return
+	}
+
+	record := audit.Record{
+		Time:        time.Now().UTC(),
+		Event:       event,
+		Namespace:   password.Namespace,
+		Name:        password.Name,
+		UID:         password.UID,
+		Generation:  password.Generation,
+		ReconcileID: controller.ReconcileIDFromContext(ctx),
+		Reason:      reason,
+		Message:     message,
+	}
+	if secret != nil {
+		record.SecretResourceVersion = secret.ResourceVersion
+	}
+	// 監査ログの書き込みに失敗してもReconcileは失敗させない
+	if err := r.Audit.Write(ctx, record); err != nil {
+		log.FromContext(ctx).Error(err, "Write audit record - failed")
+	}
+}
@@ -18,29 +18,50 @@ package controller
 
 import (
 	"context"
-	passwordGenerator "github.com/sethvargo/go-password/password"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	secretv1alpha1 "example.com/password-operator/api/v1alpha1" // api/v1alpha1/のパッケージをインポート
+	"example.com/password-operator/internal/audit"
+	"example.com/password-operator/internal/generator"
+	"example.com/password-operator/internal/history"
+	"example.com/password-operator/internal/store"
 )
 
 // PasswordReconciler reconciles a Password object
 type PasswordReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Audit receives a record of every generated value and failure. Nothing is recorded if nil.
+	Audit audit.Sink
+	// NewBackend creates the Backend of a SecretStore for spec.pushTo.
+	// store.NewBackend is used if nil.
+	NewBackend func(context.Context, client.Client, *secretv1alpha1.SecretStore) (store.Backend, error)
 }
 
 // +kubebuilder:rbac:groups=secret.example.com,resources=passwords,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=secret.example.com,resources=passwords/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=secret.example.com,resources=passwords/finalizers,verbs=update
-// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;
+// +kubebuilder:rbac:groups=secret.example.com,resources=secretstores,verbs=get;list;watch
+// +kubebuilder:rbac:groups=secret.example.com,resources=passwordpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -66,109 +87,241 @@ func (r *PasswordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 	logger.Info("Fetch Password object - succeeded", "password", password.Name, "createdAt", password.CreationTimestamp)
 
+	// Passwordが削除中の場合は、spec.retainPolicyに従ってSecretを残すか削除してからfinalizerを外す
+	if !password.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, &password)
+	}
+
+	// spec.retainPolicyがRetainまたはspec.deletionDelayが指定されている場合はfinalizerを追加し、不要になったら外す
+	if needs := needsRetentionFinalizer(&password); needs != controllerutil.ContainsFinalizer(&password, retentionFinalizer) {
+		if needs {
+			controllerutil.AddFinalizer(&password, retentionFinalizer)
+		} else {
+			controllerutil.RemoveFinalizer(&password, retentionFinalizer)
+		}
+		if err := r.Update(ctx, &password); err != nil {
+			logger.Error(err, "Update retention finalizer - failed")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// spec.replicateToが指定されている場合はfinalizerを追加
+	// （namespaceをまたいだownerReferenceは使えないため、コピーはガベージコレクタに削除されない）
+	if password.Spec.ReplicateTo != nil && !controllerutil.ContainsFinalizer(&password, replicationFinalizer) {
+		controllerutil.AddFinalizer(&password, replicationFinalizer)
+		if err := r.Update(ctx, &password); err != nil {
+			logger.Error(err, "Add finalizer - failed")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// statusのパッチはこの時点のオブジェクトとの差分で作成する
+	original := password.DeepCopy()
+
+	// spec.ttlを過ぎた値はspec.expirePolicyがDeleteの場合はSecretを削除し、作成し直さない
+	if isExpired(&password) && password.Spec.ExpirePolicy != secretv1alpha1.ExpirePolicyRegenerate {
+		logger.Info("Expire Secret - value expired", "expiresAt", expiresAt(&password))
+		return r.expireSecret(ctx, &password, original)
+	}
+
+	// spec.historySizeが小さくなった場合は、それを超える古いhistoryを削除
+	if err := r.trimHistory(ctx, &password); err != nil {
+		logger.Error(err, "Trim password history - failed")
+		return r.fail(ctx, &password, original, reasonHistoryTrimFailed, err)
+	}
+
 	// Create Secret object if not exists
 	var secret corev1.Secret
 	if err := r.Get(ctx, req.NamespacedName, &secret); err != nil {
-		if errors.IsNotFound(err) {
-			// Create Secret
-			logger.Info("Create Secret object if not exists - create secret")
-			// Generate a password that is 64 characters long with 10 digits, 10 symbols,
-			// allowing upper and lower case letters, disallowing repeat characters.
-			// passwordStr, err := passwordGenerator.Generate(64, 10, 10, false, false)
-			// Specから各設定値を取得
-			passwordStr, err := passwordGenerator.Generate(
-				password.Spec.Length,
-				password.Spec.Digit,
-				password.Spec.Symbol,
-				password.Spec.CaseSensitive,
-				password.Spec.DisallowRepeat,
-			)
-			if err != nil {
-				logger.Error(err, "Create Secret object if not exists - failed to generate password")
-
-				// PasswordオブジェクトのstatusをFailedに更新
-				password.Status.State = secretv1alpha1.PasswordFailed
-				password.Status.Reason = "failed to generate password"
-				if err := r.Status().Update(ctx, &password); err != nil {
-					logger.Error(err, "Failed to update Password status")
-					return ctrl.Result{}, err
-				}
-				return ctrl.Result{}, err
-			}
-			secret := newSecretFromPassword(&password, passwordStr)
-			// Password Objectと作成するSecretの間にreferenceを作成
-			// Password Objectが削除されたらSecretはガベージコレクタに削除される
-			err = ctrl.SetControllerReference(&password, secret, r.Scheme) // Set owner of this Secret
-			if err != nil {
-				logger.Error(err, "Create Secret object if not exists - failed to set SetControllerReference")
-
-				// PasswordオブジェクトのstatusをFailedに更新
-				password.Status.State = secretv1alpha1.PasswordFailed
-				password.Status.Reason = "failed to set SetControllerReference"
-				if err := r.Status().Update(ctx, &password); err != nil {
-					logger.Error(err, "Failed to update Password status")
-					return ctrl.Result{}, err
-				}
-				return ctrl.Result{}, err
-			}
-			// 作成実行
-			err = r.Create(ctx, secret)
-			// Secret作成失敗
-			if err != nil {
-				logger.Error(err, "Create Secret object if not exists - failed to create Secret")
-
-				// PasswordオブジェクトのstatusをInSyncに更新
-				password.Status.State = secretv1alpha1.PasswordFailed
-				password.Status.Reason = "failed to create Secret"
-				if err := r.Status().Update(ctx, &password); err != nil {
-					logger.Error(err, "Failed to update Password status")
-					return ctrl.Result{}, err
-				}
-				return ctrl.Result{}, err
-			}
-			logger.Info("Create Secret object if not exists - Secret successfully created")
-		} else {
+		if !errors.IsNotFound(err) {
 			logger.Error(err, "Create Secret object if not exists - failed to fetch Secret")
+			setCondition(&password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionUnknown, reasonSecretFetchFailed, err.Error())
+			return r.fail(ctx, &password, original, reasonSecretFetchFailed, err)
+		}
 
-			// PasswordオブジェクトのstatusをInSyncに更新
-			password.Status.State = secretv1alpha1.PasswordFailed
-			password.Status.Reason = "failed to fetch Secret"
-			if err := r.Status().Update(ctx, &password); err != nil {
-				logger.Error(err, "Failed to update Password status")
-				return ctrl.Result{}, err
+		// Create Secret
+		logger.Info("Create Secret object if not exists - create secret")
+		// 過去の値と重複しない値を生成
+		data, passwordHistory, reason, err := r.generateValue(ctx, &password)
+		if err != nil {
+			logger.Error(err, "Create Secret object if not exists - failed to generate password")
+			return r.fail(ctx, &password, original, reason, err)
+		}
+		secret = *newSecretFromPassword(&password, data)
+		// Password Objectと作成するSecretの間にreferenceを作成
+		// Password Objectが削除されたらSecretはガベージコレクタに削除される
+		if err := ctrl.SetControllerReference(&password, &secret, r.Scheme); err != nil { // Set owner of this Secret
+			logger.Error(err, "Create Secret object if not exists - failed to set SetControllerReference")
+			return r.fail(ctx, &password, original, reasonOwnerReferenceFailed, err)
+		}
+		// 作成実行
+		if err := r.Create(ctx, &secret); err != nil {
+			logger.Error(err, "Create Secret object if not exists - failed to create Secret")
+			setCondition(&password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionFalse, reasonSecretCreateFailed, err.Error())
+			return r.fail(ctx, &password, original, reasonSecretCreateFailed, err)
+		}
+		logger.Info("Create Secret object if not exists - Secret successfully created")
+		setCondition(&password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionTrue, reasonSecretCreated, "created Secret "+secret.Name)
+		r.recordEvent(ctx, &password, &secret, corev1.EventTypeNormal, eventCreated, reasonSecretCreated, "created Secret "+secret.Name)
+		// 生成日時を記録
+		r.recordGenerated(&password, passwordHistory)
+	} else if !metav1.IsControlledBy(&secret, &password) {
+		// Passwordが所有していない既存のSecretはspec.importPolicyに従って扱う
+		logger.Info("Create Secret object if not exists - import existing Secret", "importPolicy", password.Spec.ImportPolicy)
+		if reason, err := r.importSecret(ctx, &password, &secret); err != nil {
+			logger.Error(err, "Create Secret object if not exists - failed to import Secret")
+			// importPolicyがFailの場合はspec.importPolicyが変更されるまでリトライしない
+			if reason == reasonSecretExists {
+				return r.stall(ctx, &password, original, reason, err)
 			}
-			return ctrl.Result{}, err
+			return r.fail(ctx, &password, original, reason, err)
 		}
+	} else if !meta.IsStatusConditionTrue(password.Status.Conditions, secretv1alpha1.ConditionSecretCreated) {
+		setCondition(&password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionTrue, reasonSecretFound, "found Secret "+secret.Name)
 	}
+	password.Status.SecretRef = &corev1.LocalObjectReference{Name: secret.Name}
 
 	logger.Info("Create Secret object if not exists - completed")
 
-	// PasswordオブジェクトのstatusをInSyncに更新
-	password.Status.State = secretv1alpha1.PasswordInSync
-	if err := r.Status().Update(ctx, &password); err != nil {
+	// spec.expirePolicyがRegenerateの場合は、spec.ttlを過ぎた値を再生成する
+	regenerated := false
+	if isExpired(&password) && metav1.IsControlledBy(&secret, &password) {
+		logger.Info("Regenerate expired Secret", "expiresAt", expiresAt(&password))
+		if reason, err := r.regenerateExpired(ctx, &password, &secret); err != nil {
+			logger.Error(err, "Regenerate expired Secret - failed")
+			return r.fail(ctx, &password, original, reason, err)
+		}
+		regenerated = true
+	}
+	setExpiredCondition(&password, regenerated)
+
+	// spec.replicateToで指定されたnamespaceにSecretをコピー
+	replicas, err := r.syncReplicas(ctx, &password, &secret)
+	password.Status.Replicas = replicas
+	if err != nil {
+		logger.Error(err, "Replicate Secret - failed")
+		return r.fail(ctx, &password, original, reasonReplicationFailed, err)
+	}
+
+	// spec.replicateToが外された場合は、コピーの削除が完了したのでfinalizerを外す
+	// Updateはstatusをサーバーの値で上書きするため、変更したstatusを退避しておく
+	if password.Spec.ReplicateTo == nil && controllerutil.ContainsFinalizer(&password, replicationFinalizer) {
+		status := password.Status.DeepCopy()
+		controllerutil.RemoveFinalizer(&password, replicationFinalizer)
+		if err := r.Update(ctx, &password); err != nil {
+			logger.Error(err, "Remove finalizer - failed")
+			return ctrl.Result{}, err
+		}
+		password.Status = *status
+	}
+
+	// spec.pushToで指定された外部のSecretStoreに値を書き込む
+	// 失敗した場合はエラーを返し、Controllerのrate limiterによるバックオフで再実行する
+	if err := r.pushSecret(ctx, &password, &secret); err != nil {
+		logger.Error(err, "Push Secret to SecretStore - failed")
+		return r.fail(ctx, &password, original, reasonPushFailed, err)
+	}
+
+	// spec.encryptionの公開鍵で値を暗号化してConfigMapに書き出す
+	if err := r.sealSecret(ctx, &password, &secret); err != nil {
+		logger.Error(err, "Seal Secret - failed")
+		return r.fail(ctx, &password, original, reasonSealFailed, err)
+	}
+
+	// Secretの値が変わった場合はspec.rolloutTargetsのワークロードを再起動する
+	rollouts, err := r.rollout(ctx, &password, &secret)
+	password.Status.Rollouts = rollouts
+	if err != nil {
+		logger.Error(err, "Rollout workloads - failed")
+		return r.fail(ctx, &password, original, reasonRolloutFailed, err)
+	}
+
+	// PasswordオブジェクトのReady conditionをTrueに更新
+	setCondition(&password, secretv1alpha1.ConditionReady, metav1.ConditionTrue, reasonReconciled, "Secret is in sync")
+	if err := r.patchStatus(ctx, &password, original); err != nil {
 		logger.Error(err, "Failed to update Password status")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// spec.ttlが指定されている場合は、値の有効期限に再度Reconcileする
+	return requeueAfterExpiry(&password), nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PasswordReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&secretv1alpha1.Password{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.ConfigMap{}).
+		// 他のnamespaceにコピーしたSecretが変更・削除されたら元に戻す
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.passwordForReplica)).
+		// namespaceSelectorに一致するnamespaceが作成されたらコピーを作成する
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.passwordsForNamespace)).
+		// SecretStoreが変更されたら参照しているPasswordの値を書き込み直す
+		Watches(&source.Kind{Type: &secretv1alpha1.SecretStore{}}, handler.EnqueueRequestsFromMapFunc(r.passwordsForSecretStore)).
+		// 公開鍵が変更されたら暗号化し直す
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.passwordsForPublicKey)).
+		// PasswordPolicyが変更されたら、基準を満たさずに生成を保留しているPasswordを再度Reconcileする
+		Watches(&source.Kind{Type: &secretv1alpha1.PasswordPolicy{}}, handler.EnqueueRequestsFromMapFunc(r.passwordsForPolicy)).
 		Complete(r)
 }
 
-func newSecretFromPassword(password *secretv1alpha1.Password, passwordStr string) *corev1.Secret {
+// generateValue generates a value for the Secret of password that is not in its history,
+// adds it to the history and records the result in the PolicySatisfied condition.
+// It returns the reason of the Ready condition if it fails.
+func (r *PasswordReconciler) generateValue(ctx context.Context, password *secretv1alpha1.Password) (map[string][]byte, history.History, string, error) {
+	// 過去に生成した値のハッシュを取得
+	passwordHistory, err := r.loadHistory(ctx, password)
+	if err != nil {
+		return nil, nil, reasonHistoryFetchFailed, err
+	}
+	spec, reason, err := r.generatorSpec(ctx, password)
+	if err != nil {
+		return nil, nil, reason, err
+	}
+	// spec.generatorで選択されたGeneratorでSecretの値を生成（historyに含まれる値は再生成）
+	data, err := generateUnusedSecretData(spec, passwordHistory)
+	if err != nil {
+		setCondition(password, secretv1alpha1.ConditionPolicySatisfied, metav1.ConditionFalse, reasonGenerateFailed, err.Error())
+		return nil, nil, reasonGenerateFailed, err
+	}
+	setCondition(password, secretv1alpha1.ConditionPolicySatisfied, metav1.ConditionTrue, reasonPolicySatisfied, "generated value satisfies the spec")
+
+	// 生成した値のハッシュはSecretに書き込む前にhistoryに追加する
+	// Secretの書き込みに失敗しても、使われなかった値がhistoryに残るだけで、書き込んだ値が記録されないことはない
+	if password.Spec.HistorySize > 0 {
+		passwordHistory, err = r.recordHistory(ctx, password, passwordHistory, data)
+		if err != nil {
+			return nil, nil, reasonHistoryRecordFailed, err
+		}
+	}
+	return data, passwordHistory, "", nil
+}
+
+// recordGenerated records that a value generated by generateValue was written to the Secret of password:
+// the Rotated condition, status.lastGeneratedTime and status.historyDepth.
+func (r *PasswordReconciler) recordGenerated(password *secretv1alpha1.Password, passwordHistory history.History) {
+	setCondition(password, secretv1alpha1.ConditionRotated, metav1.ConditionTrue, reasonGenerated, "generated a new value")
+	now := metav1.Now()
+	password.Status.LastGeneratedTime = &now
+	password.Status.HistoryDepth = len(passwordHistory)
+}
+
+func generateSecretData(spec secretv1alpha1.PasswordSpec) (map[string][]byte, error) {
+	g, err := generator.New(spec)
+	if err != nil {
+		return nil, err
+	}
+	return g.Generate()
+}
+
+func newSecretFromPassword(password *secretv1alpha1.Password, data map[string][]byte) *corev1.Secret {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      password.Name,
 			Namespace: password.Namespace,
 		},
-		Data: map[string][]byte{
-			"password": []byte(passwordStr),
-		},
+		Data: data,
 	}
 	return secret
 }
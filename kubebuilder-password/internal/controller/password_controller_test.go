@@ -0,0 +1,554 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+	"example.com/password-operator/internal/generator"
+	"example.com/password-operator/internal/history"
+)
+
+const (
+	passwordNamespace = "default"
+	timeout           = time.Second * 10
+	interval          = time.Millisecond * 250
+)
+
+func newTestPassword(name string, spec secretv1alpha1.PasswordSpec) *secretv1alpha1.Password {
+	return &secretv1alpha1.Password{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: passwordNamespace},
+		Spec:       spec,
+	}
+}
+
+// readyCondition returns the Ready condition of the Password named name, or nil if it is not set yet.
+func readyCondition(name string) func() *metav1.Condition {
+	return func() *metav1.Condition {
+		var password secretv1alpha1.Password
+		if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: passwordNamespace, Name: name}, &password); err != nil {
+			return nil
+		}
+		return meta.FindStatusCondition(password.Status.Conditions, secretv1alpha1.ConditionReady)
+	}
+}
+
+func haveStatus(status metav1.ConditionStatus, reason string) OmegaMatcher {
+	return And(Not(BeNil()), WithTransform(func(c *metav1.Condition) metav1.ConditionStatus { return c.Status }, Equal(status)),
+		WithTransform(func(c *metav1.Condition) string { return c.Reason }, Equal(reason)))
+}
+
+var _ = Describe("PasswordController", func() {
+	// Passwordが作成されたらSecretが作成されることをテスト
+	Context("When Password is created", func() {
+		It("Secret should be created and owned by the Password", func() {
+			password := newTestPassword("create", secretv1alpha1.PasswordSpec{Length: 20, Digit: 5, Symbol: 5})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			// Password作成後、すぐにはSecretが作成されていないためEventuallyで待つ
+			secret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)
+			}, timeout, interval).Should(Succeed())
+
+			Expect(secret.Data[generator.PasswordKey]).To(HaveLen(20))
+			Expect(metav1.IsControlledBy(secret, password)).To(BeTrue())
+		})
+	})
+
+	// statusのconditionなどが更新されることをテスト
+	Context("When Password is reconciled", func() {
+		It("status should report the Secret", func() {
+			password := newTestPassword("status", secretv1alpha1.PasswordSpec{Length: 20})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionTrue, reasonReconciled))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(password.Status.Conditions, secretv1alpha1.ConditionSecretCreated)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(password.Status.Conditions, secretv1alpha1.ConditionRotated)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(password.Status.Conditions, secretv1alpha1.ConditionPolicySatisfied)).To(BeTrue())
+			Expect(password.Status.SecretRef).To(Equal(&corev1.LocalObjectReference{Name: password.Name}))
+			Expect(password.Status.LastGeneratedTime).NotTo(BeNil())
+			Expect(password.Status.ObservedGeneration).To(Equal(password.Generation))
+
+			// specを更新するとobservedGenerationが追従する
+			password.Spec.Length = 30
+			Expect(k8sClient.Update(ctx, password)).To(Succeed())
+			Eventually(func() int64 {
+				var updated secretv1alpha1.Password
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(password), &updated); err != nil {
+					return 0
+				}
+				return updated.Status.ObservedGeneration
+			}, timeout, interval).Should(Equal(password.Generation))
+		})
+	})
+
+	// webhookを通さずに不正なspecのPasswordを作成するとFailedになることをテスト
+	Context("When the Password can't be generated", func() {
+		It("status should report the failure and no Secret should be created", func() {
+			password := newTestPassword("generate-failed", secretv1alpha1.PasswordSpec{Length: 10, Digit: 6, Symbol: 6})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionFalse, reasonGenerateFailed))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(password.Status.Conditions, secretv1alpha1.ConditionPolicySatisfied)).To(BeTrue())
+			Expect(password.Status.SecretRef).To(BeNil())
+
+			secret := &corev1.Secret{}
+			Consistently(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)
+			}, time.Second, interval).ShouldNot(Succeed())
+		})
+	})
+
+	// webhookの検証後に基準を満たさなくなったPasswordPolicyを参照すると生成されないことをテスト
+	Context("When the referenced PasswordPolicy is weaker than its own bounds", func() {
+		It("PolicySatisfied should be False and no Secret should be created", func() {
+			policy := &secretv1alpha1.PasswordPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "weak-policy"},
+				Spec:       secretv1alpha1.PasswordPolicySpec{Length: 8, MinLength: 32},
+			}
+			Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, policy)).To(Succeed())
+			})
+
+			password := newTestPassword("weak-policy", secretv1alpha1.PasswordSpec{Length: 20, PolicyRef: policy.Name})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionFalse, reasonWeakerThanPolicy))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(password.Status.Conditions, secretv1alpha1.ConditionPolicySatisfied)).To(BeTrue())
+			Expect(password.Status.SecretRef).To(BeNil())
+
+			secret := &corev1.Secret{}
+			Consistently(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)
+			}, time.Second, interval).ShouldNot(Succeed())
+
+			// PasswordPolicyを修正すると生成される
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(policy), policy)).To(Succeed())
+			policy.Spec.Length = 32
+			Expect(k8sClient.Update(ctx, policy)).To(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)
+			}, timeout, interval).Should(Succeed())
+			Expect(secret.Data[generator.PasswordKey]).To(HaveLen(32))
+		})
+	})
+
+	// "<name>-history"という名前のPasswordのSecretがhistoryとして上書きされないことをテスト
+	Context("When the history Secret name is taken by another Password", func() {
+		It("the other Secret should be kept and the Password should fail", func() {
+			other := newTestPassword("collide-history", secretv1alpha1.PasswordSpec{Length: 20})
+			Expect(k8sClient.Create(ctx, other)).To(Succeed())
+			otherSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(other), otherSecret)
+			}, timeout, interval).Should(Succeed())
+			value := otherSecret.Data[generator.PasswordKey]
+
+			password := newTestPassword("collide", secretv1alpha1.PasswordSpec{Length: 20, HistorySize: 3})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionFalse, reasonHistoryFetchFailed))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(other), otherSecret)).To(Succeed())
+			Expect(otherSecret.Data).NotTo(HaveKey(historyKey))
+			Expect(otherSecret.Data[generator.PasswordKey]).To(Equal(value))
+			Expect(metav1.IsControlledBy(otherSecret, other)).To(BeTrue())
+		})
+	})
+
+	// spec.historySizeを小さくするとhistoryが切り詰められ、0にするとhistory Secretが削除されることをテスト
+	Context("When spec.historySize is lowered", func() {
+		It("the history should be trimmed and deleted at 0", func() {
+			password := newTestPassword("trim-history", secretv1alpha1.PasswordSpec{Length: 20, HistorySize: 3})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			historyDepth := func() int {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password); err != nil {
+					return -1
+				}
+				return password.Status.HistoryDepth
+			}
+			Eventually(historyDepth, timeout, interval).Should(Equal(1))
+
+			// Secretを削除すると値が再生成され、historyに追加される
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+			Eventually(historyDepth, timeout, interval).Should(Equal(2))
+
+			historySecret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, historySecretName(password), historySecret)).To(Succeed())
+			records, err := history.Parse(historySecret.Data[historyKey])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password); err != nil {
+					return err
+				}
+				password.Spec.HistorySize = 1
+				return k8sClient.Update(ctx, password)
+			}, timeout, interval).Should(Succeed())
+			Eventually(historyDepth, timeout, interval).Should(Equal(1))
+			Expect(k8sClient.Get(ctx, historySecretName(password), historySecret)).To(Succeed())
+			trimmed, err := history.Parse(historySecret.Data[historyKey])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(trimmed).To(Equal(records[:1]))
+
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password); err != nil {
+					return err
+				}
+				password.Spec.HistorySize = 0
+				return k8sClient.Update(ctx, password)
+			}, timeout, interval).Should(Succeed())
+			Eventually(func() bool {
+				return apierrors.IsNotFound(k8sClient.Get(ctx, historySecretName(password), historySecret))
+			}, timeout, interval).Should(BeTrue())
+			Eventually(historyDepth, timeout, interval).Should(Equal(0))
+		})
+	})
+
+	// ラベル値の上限（63文字）より長い名前のPasswordのSecretがコピーされることをテスト
+	Context("When a Password with a long name is replicated", func() {
+		It("the copy should point back to the Password and be deleted when deselected", func() {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "replica-target"}}
+			Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+
+			name := "replicated-" + strings.Repeat("x", 80)
+			password := newTestPassword(name, secretv1alpha1.PasswordSpec{
+				Length:      20,
+				ReplicateTo: &secretv1alpha1.ReplicationSpec{Namespaces: []string{namespace.Name}},
+			})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			replica := &corev1.Secret{}
+			key := types.NamespacedName{Namespace: namespace.Name, Name: name}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, key, replica)
+			}, timeout, interval).Should(Succeed())
+			Expect(replica.Annotations).To(HaveKeyWithValue(sourceNamespaceAnnotation, passwordNamespace))
+			Expect(replica.Annotations).To(HaveKeyWithValue(sourceNameAnnotation, name))
+			Expect(replica.Labels).To(HaveKey(sourceLabel))
+			Expect(len(replica.Labels[sourceLabel])).To(BeNumerically("<=", 63))
+
+			// spec.replicateToから外すとコピーが削除される
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password)).To(Succeed())
+			password.Spec.ReplicateTo = nil
+			Expect(k8sClient.Update(ctx, password)).To(Succeed())
+			Eventually(func() bool {
+				return apierrors.IsNotFound(k8sClient.Get(ctx, key, replica))
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	// ガベージコレクタ（envtestでは動かない）がSecretを削除するためのownerReferenceをテスト
+	Context("When Password is deleted", func() {
+		It("Secret should be garbage collectable with the Delete policy", func() {
+			password := newTestPassword("delete", secretv1alpha1.PasswordSpec{Length: 20})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			secret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)
+			}, timeout, interval).Should(Succeed())
+
+			ref := metav1.GetControllerOf(secret)
+			Expect(ref).NotTo(BeNil())
+			Expect(ref.UID).To(Equal(password.UID))
+			Expect(ref.BlockOwnerDeletion).To(Equal(ptrTo(true)))
+
+			// finalizerが無いため、Passwordはすぐに削除される
+			Expect(k8sClient.Delete(ctx, password)).To(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(password), &secretv1alpha1.Password{})
+			}, timeout, interval).ShouldNot(Succeed())
+		})
+
+		It("Secret and sealed ConfigMap should be orphaned with the Retain policy", func() {
+			key, err := ecdh.X25519().GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.MarshalPKIXPublicKey(key.PublicKey())
+			Expect(err).NotTo(HaveOccurred())
+			publicKey := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "retain-public-key", Namespace: passwordNamespace},
+				Data:       map[string]string{"public.pem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+			}
+			Expect(k8sClient.Create(ctx, publicKey)).To(Succeed())
+
+			password := newTestPassword("retain", secretv1alpha1.PasswordSpec{
+				Length:       20,
+				RetainPolicy: secretv1alpha1.RetainPolicyRetain,
+				Encryption: &secretv1alpha1.EncryptionSpec{
+					PublicKeyRef: secretv1alpha1.ConfigMapKeySelector{Name: publicKey.Name, Key: "public.pem"},
+				},
+			})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionTrue, reasonReconciled))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password)).To(Succeed())
+			Expect(password.Finalizers).To(ContainElement(retentionFinalizer))
+			Expect(password.Status.SealedRef).NotTo(BeNil())
+
+			Expect(k8sClient.Delete(ctx, password)).To(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(password), &secretv1alpha1.Password{})
+			}, timeout, interval).ShouldNot(Succeed())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)).To(Succeed())
+			Expect(secret.OwnerReferences).To(BeEmpty())
+			sealed := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, sealedConfigMapName(password), sealed)).To(Succeed())
+			Expect(sealed.OwnerReferences).To(BeEmpty())
+			Expect(auditSink.events(password.Name)).To(ContainElement(eventRetained))
+		})
+	})
+
+	// 同じPasswordを何度Reconcileしても値が変わらないことをテスト
+	Context("When Password is reconciled repeatedly", func() {
+		It("Secret should not change", func() {
+			password := newTestPassword("idempotent", secretv1alpha1.PasswordSpec{Length: 20})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionTrue, reasonReconciled))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)).To(Succeed())
+
+			reconciler := &PasswordReconciler{
+				Client:   k8sClient,
+				Scheme:   scheme.Scheme,
+				Recorder: record.NewFakeRecorder(100),
+			}
+			for i := 0; i < 3; i++ {
+				result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(password)})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(ctrl.Result{}))
+			}
+
+			reconciled := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), reconciled)).To(Succeed())
+			Expect(reconciled.ResourceVersion).To(Equal(secret.ResourceVersion))
+			Expect(reconciled.Data).To(Equal(secret.Data))
+		})
+	})
+
+	// Passwordが所有していないSecretがspec.importPolicyに従って扱われることをテスト
+	Context("When a Secret already exists", func() {
+		It("Password should fail with the Fail policy", func() {
+			existing := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "import-fail", Namespace: passwordNamespace},
+				Data:       map[string][]byte{generator.PasswordKey: []byte("existing")},
+			}
+			Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+
+			password := newTestPassword(existing.Name, secretv1alpha1.PasswordSpec{Length: 20, ImportPolicy: secretv1alpha1.ImportPolicyFail})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionFalse, reasonSecretExists))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(existing), secret)).To(Succeed())
+			Expect(secret.OwnerReferences).To(BeEmpty())
+			Expect(secret.Data).To(Equal(existing.Data))
+
+			// spec.importPolicyを変更すると再度Reconcileされる
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password)).To(Succeed())
+			password.Spec.ImportPolicy = secretv1alpha1.ImportPolicyOverwrite
+			Expect(k8sClient.Update(ctx, password)).To(Succeed())
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionTrue, reasonReconciled))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(existing), secret)).To(Succeed())
+			Expect(metav1.IsControlledBy(secret, password)).To(BeTrue())
+			Expect(secret.Data).NotTo(Equal(existing.Data))
+		})
+
+		It("Password should keep a value satisfying the spec with the Adopt policy", func() {
+			existing := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "import-adopt", Namespace: passwordNamespace},
+				Data:       map[string][]byte{generator.PasswordKey: []byte("abcdefghijklmnopqrst")},
+			}
+			Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+
+			password := newTestPassword(existing.Name, secretv1alpha1.PasswordSpec{Length: 20, ImportPolicy: secretv1alpha1.ImportPolicyAdopt})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionTrue, reasonReconciled))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(existing), secret)).To(Succeed())
+			Expect(metav1.IsControlledBy(secret, password)).To(BeTrue())
+			Expect(secret.Data).To(Equal(existing.Data))
+		})
+	})
+
+	// spec.rolloutTargetsのワークロードが値の再生成後にだけ再起動されることをテスト
+	Context("When rollout targets are set", func() {
+		It("workloads should be restarted only after the value changes", func() {
+			labels := map[string]string{"app": "rollout"}
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "rollout-app", Namespace: passwordNamespace},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: labels},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+			password := newTestPassword("rollout", secretv1alpha1.PasswordSpec{
+				Length:         20,
+				RolloutTargets: []secretv1alpha1.RolloutTarget{{Kind: secretv1alpha1.RolloutKindDeployment, Name: deployment.Name}},
+			})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			// 選択されただけでは再起動せず、基準のハッシュだけを記録する
+			Eventually(func() []secretv1alpha1.RolloutStatus {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password); err != nil {
+					return nil
+				}
+				return password.Status.Rollouts
+			}, timeout, interval).Should(HaveLen(1))
+			baseline := password.Status.Rollouts[0]
+			Expect(baseline.SecretHash).NotTo(BeEmpty())
+			Expect(baseline.RestartedAt).To(BeNil())
+			Consistently(func() map[string]string {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), deployment); err != nil {
+					return nil
+				}
+				return deployment.Spec.Template.Annotations
+			}, time.Second, interval).ShouldNot(HaveKey(secretHashAnnotation))
+
+			// Secretを削除すると値が再生成され、ワークロードが再起動される
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), deployment); err != nil {
+					return ""
+				}
+				return deployment.Spec.Template.Annotations[secretHashAnnotation]
+			}, timeout, interval).ShouldNot(BeEmpty())
+
+			Eventually(func() *metav1.Time {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password); err != nil || len(password.Status.Rollouts) != 1 {
+					return nil
+				}
+				return password.Status.Rollouts[0].RestartedAt
+			}, timeout, interval).ShouldNot(BeNil())
+			Expect(password.Status.Rollouts[0].SecretHash).To(Equal(deployment.Spec.Template.Annotations[secretHashAnnotation]))
+			Expect(password.Status.Rollouts[0].SecretHash).NotTo(Equal(baseline.SecretHash))
+
+			// 再起動は監査ログにも記録される
+			Eventually(func() []string { return auditSink.events(password.Name) }, timeout, interval).Should(ContainElement(eventRolledOut))
+		})
+
+		It("workloads in a foreign namespace should not be restarted", func() {
+			password := newTestPassword("rollout-foreign", secretv1alpha1.PasswordSpec{
+				Length:         20,
+				RolloutTargets: []secretv1alpha1.RolloutTarget{{Kind: secretv1alpha1.RolloutKindDeployment, Name: "app", Namespace: "kube-system"}},
+			})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionFalse, reasonRolloutFailed))
+		})
+	})
+
+	// spec.ttlを過ぎた値がspec.expirePolicyに従って扱われることをテスト
+	Context("When the value outlives spec.ttl", func() {
+		It("Secret should be deleted and not created again with the Delete policy", func() {
+			password := newTestPassword("expire-delete", secretv1alpha1.PasswordSpec{Length: 20, TTL: &metav1.Duration{Duration: 2 * time.Second}})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			Eventually(readyCondition(password.Name), timeout, interval).Should(haveStatus(metav1.ConditionFalse, reasonExpired))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(password.Status.Conditions, secretv1alpha1.ConditionExpired)).To(BeTrue())
+			Expect(password.Status.ExpiresAt).NotTo(BeNil())
+			Expect(password.Status.SecretRef).To(BeNil())
+
+			secret := &corev1.Secret{}
+			Consistently(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)
+			}, time.Second, interval).ShouldNot(Succeed())
+		})
+
+		It("Secret should be regenerated with the Regenerate policy", func() {
+			password := newTestPassword("expire-regenerate", secretv1alpha1.PasswordSpec{
+				Length:       20,
+				TTL:          &metav1.Duration{Duration: 2 * time.Second},
+				ExpirePolicy: secretv1alpha1.ExpirePolicyRegenerate,
+			})
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+
+			secret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret)
+			}, timeout, interval).Should(Succeed())
+			first := secret.Data[generator.PasswordKey]
+
+			Eventually(func() []byte {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(password), secret); err != nil {
+					return nil
+				}
+				return secret.Data[generator.PasswordKey]
+			}, timeout, interval).ShouldNot(Equal(first))
+
+			// 再生成後もExpired conditionのメッセージは新しい値の有効期限を示す
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(password), password); err != nil || password.Status.ExpiresAt == nil {
+					return ""
+				}
+				condition := meta.FindStatusCondition(password.Status.Conditions, secretv1alpha1.ConditionExpired)
+				if condition == nil || !strings.HasSuffix(condition.Message, password.Status.ExpiresAt.UTC().Format(time.RFC3339)) {
+					return ""
+				}
+				return condition.Reason
+			}, timeout, interval).Should(BeElementOf(reasonNotExpired, reasonRegenerated))
+		})
+	})
+})
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
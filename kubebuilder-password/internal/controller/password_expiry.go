@@ -0,0 +1,148 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+// Reasons of the Expired condition and of the events recorded when a value expires.
+const (
+	eventExpired       = "Expired"
+	reasonExpired      = "Expired"
+	reasonNotExpired   = "NotExpired"
+	reasonExpireFailed = "ExpireFailed"
+	reasonRegenerated  = "Regenerated"
+	reasonNoTTL        = "NoTTL"
+)
+
+// expiresAt returns the time the value of the Secret of password expires, or nil without spec.ttl.
+// The ttl is counted from the last generation, or from the creation of the Password if the
+// value of an adopted Secret was kept.
+func expiresAt(password *secretv1alpha1.Password) *metav1.Time {
+	if password.Spec.TTL == nil {
+		return nil
+	}
+	generated := password.CreationTimestamp
+	if password.Status.LastGeneratedTime != nil {
+		generated = *password.Status.LastGeneratedTime
+	}
+	t := metav1.NewTime(generated.Add(password.Spec.TTL.Duration))
+	return &t
+}
+
+// isExpired reports whether the value of the Secret of password outlived spec.ttl.
+func isExpired(password *secretv1alpha1.Password) bool {
+	t := expiresAt(password)
+	return t != nil && !time.Now().Before(t.Time)
+}
+
+// requeueAfterExpiry returns the Result that reconciles password again when its value expires.
+func requeueAfterExpiry(password *secretv1alpha1.Password) ctrl.Result {
+	if password.Status.ExpiresAt == nil {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: time.Until(password.Status.ExpiresAt.Time)}
+}
+
+// setExpiredCondition updates status.expiresAt and the Expired condition of a Password whose value has not expired.
+// regenerated reports whether the value was regenerated after spec.ttl in the current reconcile.
+func setExpiredCondition(password *secretv1alpha1.Password, regenerated bool) {
+	password.Status.ExpiresAt = expiresAt(password)
+	if password.Status.ExpiresAt == nil {
+		// ttlを指定していないPasswordにはconditionを追加しない
+		if meta.FindStatusCondition(password.Status.Conditions, secretv1alpha1.ConditionExpired) != nil {
+			setCondition(password, secretv1alpha1.ConditionExpired, metav1.ConditionFalse, reasonNoTTL, "spec.ttl is not set")
+		}
+		return
+	}
+	reason, message := reasonNotExpired, "value expires at "+password.Status.ExpiresAt.UTC().Format(time.RFC3339)
+	// 再生成したReconcileでだけ理由をRegeneratedにする（以降のReconcileではNotExpiredに戻る）
+	if regenerated {
+		reason, message = reasonRegenerated, "regenerated the expired value; "+message
+	}
+	setCondition(password, secretv1alpha1.ConditionExpired, metav1.ConditionFalse, reason, message)
+}
+
+// expireSecret deletes the Secret of password and its copies after spec.ttl when spec.expirePolicy is Delete
+// and marks password Expired. The Secret is not created again until spec.ttl is removed or extended.
+func (r *PasswordReconciler) expireSecret(ctx context.Context, password, original *secretv1alpha1.Password) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	password.Status.ExpiresAt = expiresAt(password)
+
+	// Passwordが所有していないSecretは削除しない
+	var secret corev1.Secret
+	if err := r.Get(ctx, client.ObjectKeyFromObject(password), &secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "Expire Secret - failed to fetch Secret")
+			return r.fail(ctx, password, original, reasonExpireFailed, err)
+		}
+	} else if metav1.IsControlledBy(&secret, password) {
+		if err := r.Delete(ctx, &secret); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, "Expire Secret - failed to delete Secret")
+			return r.fail(ctx, password, original, reasonExpireFailed, err)
+		}
+	}
+	if err := r.deleteReplicas(ctx, password); err != nil {
+		logger.Error(err, "Expire Secret - failed to delete replicated Secrets")
+		return r.fail(ctx, password, original, reasonExpireFailed, err)
+	}
+
+	message := "value expired at " + password.Status.ExpiresAt.UTC().Format(time.RFC3339) + "; deleted Secret " + password.Name
+	if !meta.IsStatusConditionTrue(password.Status.Conditions, secretv1alpha1.ConditionExpired) {
+		r.recordEvent(ctx, password, nil, corev1.EventTypeNormal, eventExpired, reasonExpired, message)
+	}
+	setCondition(password, secretv1alpha1.ConditionExpired, metav1.ConditionTrue, reasonExpired, message)
+	setCondition(password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionFalse, reasonExpired, message)
+	setCondition(password, secretv1alpha1.ConditionReady, metav1.ConditionFalse, reasonExpired, message)
+	password.Status.SecretRef = nil
+	password.Status.Replicas = nil
+	if err := r.patchStatus(ctx, password, original); err != nil {
+		logger.Error(err, "Failed to update Password status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// regenerateExpired replaces the value of secret after spec.ttl when spec.expirePolicy is Regenerate.
+// It returns the reason of the Ready condition if it fails.
+func (r *PasswordReconciler) regenerateExpired(ctx context.Context, password *secretv1alpha1.Password, secret *corev1.Secret) (string, error) {
+	expired := expiresAt(password)
+	data, passwordHistory, reason, err := r.generateValue(ctx, password)
+	if err != nil {
+		return reason, err
+	}
+	secret.Data = data
+	if err := r.Update(ctx, secret); err != nil {
+		return reasonExpireFailed, err
+	}
+	message := "value expired at " + expired.UTC().Format(time.RFC3339) + "; regenerated Secret " + secret.Name
+	r.recordEvent(ctx, password, secret, corev1.EventTypeNormal, eventRotated, reasonExpired, message)
+	r.recordGenerated(password, passwordHistory)
+	return "", nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+	"example.com/password-operator/internal/generator"
+	"example.com/password-operator/internal/history"
+)
+
+const (
+	// historySecretSuffix is appended to the Password name to name the Secret holding its history.
+	historySecretSuffix = "-history"
+	historyKey          = "history"
+	// maxGenerateAttempts bounds how often a value found in the history is regenerated.
+	maxGenerateAttempts = 10
+)
+
+var (
+	ErrValueInHistory = errors.New("generated value was found in the password history")
+	// ErrHistorySecretNotOwned is returned when the history Secret name is taken by a Secret
+	// the Password doesn't control, e.g. the Secret of a Password named "<name>-history".
+	ErrHistorySecretNotOwned = errors.New("history Secret already exists and is not owned by the Password")
+)
+
+// historySecretName returns the name of the Secret holding the history of password.
+// A Password named "<name>-history" in the same namespace uses the same name for its own Secret,
+// so the history Secret is only read and written while password controls it.
+func historySecretName(password *secretv1alpha1.Password) types.NamespacedName {
+	return types.NamespacedName{Namespace: password.Namespace, Name: password.Name + historySecretSuffix}
+}
+
+// historyValue returns the value of data that must not be reused.
+func historyValue(data map[string][]byte) []byte {
+	if v, ok := data[generator.PasswordKey]; ok {
+		return v
+	}
+	return data[generator.PrivateKeyKey]
+}
+
+// generateUnusedSecretData generates Secret data whose value is not in h.
+func generateUnusedSecretData(spec secretv1alpha1.PasswordSpec, h history.History) (map[string][]byte, error) {
+	for i := 0; i < maxGenerateAttempts; i++ {
+		data, err := generateSecretData(spec)
+		if err != nil {
+			return nil, err
+		}
+		if !h.Contains(historyValue(data)) {
+			return data, nil
+		}
+	}
+	return nil, ErrValueInHistory
+}
+
+// loadHistory returns the history of password, or an empty history if it has none yet.
+func (r *PasswordReconciler) loadHistory(ctx context.Context, password *secretv1alpha1.Password) (history.History, error) {
+	var secret corev1.Secret
+	if err := r.Get(ctx, historySecretName(password), &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return history.History{}, nil
+		}
+		return nil, err
+	}
+	if !metav1.IsControlledBy(&secret, password) {
+		// historyを使わないPasswordは同名の他のSecretに影響されない
+		if password.Spec.HistorySize == 0 {
+			return history.History{}, nil
+		}
+		return nil, fmt.Errorf("%w: Secret %s", ErrHistorySecretNotOwned, secret.Name)
+	}
+	return history.Parse(secret.Data[historyKey])
+}
+
+// recordHistory adds the value of data to the history Secret of password, which is owned by password.
+func (r *PasswordReconciler) recordHistory(ctx context.Context, password *secretv1alpha1.Password, h history.History, data map[string][]byte) (history.History, error) {
+	h, err := h.Add(historyValue(data), time.Now(), password.Spec.HistorySize)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := h.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	key := historySecretName(password)
+	var secret corev1.Secret
+	if err := r.Get(ctx, key, &secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		secret = corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+			},
+			Data: map[string][]byte{historyKey: encoded},
+		}
+		if err := ctrl.SetControllerReference(password, &secret, r.Scheme); err != nil {
+			return nil, err
+		}
+		return h, r.Create(ctx, &secret)
+	}
+	// 他のPassword（例: "<name>-history"という名前のPassword）のSecretを上書きしない
+	if !metav1.IsControlledBy(&secret, password) {
+		return nil, fmt.Errorf("%w: Secret %s", ErrHistorySecretNotOwned, secret.Name)
+	}
+	secret.Data = map[string][]byte{historyKey: encoded}
+	return h, r.Update(ctx, &secret)
+}
+
+// trimHistory keeps at most spec.historySize records in the history Secret of password and
+// updates status.historyDepth, so that lowering spec.historySize takes effect without waiting
+// for the next generation. The history Secret is deleted when spec.historySize is 0.
+func (r *PasswordReconciler) trimHistory(ctx context.Context, password *secretv1alpha1.Password) error {
+	var secret corev1.Secret
+	if err := r.Get(ctx, historySecretName(password), &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			password.Status.HistoryDepth = 0
+			return nil
+		}
+		return err
+	}
+	// 他のPasswordのSecretは変更しない
+	if !metav1.IsControlledBy(&secret, password) {
+		password.Status.HistoryDepth = 0
+		return nil
+	}
+	if password.Spec.HistorySize == 0 {
+		password.Status.HistoryDepth = 0
+		return client.IgnoreNotFound(r.Delete(ctx, &secret))
+	}
+
+	h, err := history.Parse(secret.Data[historyKey])
+	if err != nil {
+		return err
+	}
+	if len(h) > password.Spec.HistorySize {
+		h = h.Trim(password.Spec.HistorySize)
+		encoded, err := h.Marshal()
+		if err != nil {
+			return err
+		}
+		secret.Data = map[string][]byte{historyKey: encoded}
+		if err := r.Update(ctx, &secret); err != nil {
+			return err
+		}
+	}
+	password.Status.HistoryDepth = len(h)
+	return nil
+}
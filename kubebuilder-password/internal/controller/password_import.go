@@ -0,0 +1,104 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+	"example.com/password-operator/internal/generator"
+)
+
+// Reasons of the SecretCreated condition for a Secret that existed before the Password.
+const (
+	reasonSecretExists       = "SecretExists"
+	reasonSecretAdopted      = "Adopted"
+	reasonSecretOverwritten  = "Overwritten"
+	reasonSecretImportFailed = "ImportFailed"
+)
+
+var ErrSecretNotOwned = errors.New("Secret already exists and is not owned by the Password")
+
+// importSecret applies spec.importPolicy to secret, which exists but is not controlled by password.
+// Adopt keeps the value of secret if it satisfies the spec and generates a new one otherwise,
+// Overwrite always generates a new one.
+// It returns the reason of the Ready condition if it fails.
+func (r *PasswordReconciler) importSecret(ctx context.Context, password *secretv1alpha1.Password, secret *corev1.Secret) (string, error) {
+	logger := log.FromContext(ctx)
+
+	policy := password.Spec.ImportPolicy
+	if policy != secretv1alpha1.ImportPolicyAdopt && policy != secretv1alpha1.ImportPolicyOverwrite {
+		err := fmt.Errorf("%w: %s (set spec.importPolicy to Adopt or Overwrite to take it over)", ErrSecretNotOwned, secret.Name)
+		setCondition(password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionFalse, reasonSecretExists, err.Error())
+		return reasonSecretExists, err
+	}
+
+	// 他のコントローラーが所有しているSecretは引き継がない
+	if err := ctrl.SetControllerReference(password, secret, r.Scheme); err != nil {
+		setCondition(password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionFalse, reasonSecretImportFailed, err.Error())
+		return reasonOwnerReferenceFailed, err
+	}
+
+	regenerate := policy == secretv1alpha1.ImportPolicyOverwrite
+	if policy == secretv1alpha1.ImportPolicyAdopt {
+		spec, reason, err := r.generatorSpec(ctx, password)
+		if err != nil {
+			return reason, err
+		}
+		g, err := generator.New(spec)
+		if err != nil {
+			return reasonGenerateFailed, err
+		}
+		if err := g.Validate(secret.Data); err != nil {
+			logger.Info("Existing Secret does not satisfy the spec - generate a new value", "reason", err.Error())
+			regenerate = true
+		} else {
+			setCondition(password, secretv1alpha1.ConditionPolicySatisfied, metav1.ConditionTrue, reasonPolicySatisfied, "existing value satisfies the spec")
+		}
+	}
+
+	if !regenerate {
+		if err := r.Update(ctx, secret); err != nil {
+			setCondition(password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionFalse, reasonSecretImportFailed, err.Error())
+			return reasonSecretImportFailed, err
+		}
+		setCondition(password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionTrue, reasonSecretAdopted, "adopted existing Secret "+secret.Name)
+		r.recordEvent(ctx, password, secret, corev1.EventTypeNormal, eventAdopted, reasonSecretAdopted, "adopted existing Secret "+secret.Name)
+		return "", nil
+	}
+
+	data, passwordHistory, reason, err := r.generateValue(ctx, password)
+	if err != nil {
+		return reason, err
+	}
+	secret.Data = data
+	if err := r.Update(ctx, secret); err != nil {
+		setCondition(password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionFalse, reasonSecretImportFailed, err.Error())
+		return reasonSecretImportFailed, err
+	}
+	setCondition(password, secretv1alpha1.ConditionSecretCreated, metav1.ConditionTrue, reasonSecretOverwritten, "replaced the value of existing Secret "+secret.Name)
+	r.recordEvent(ctx, password, secret, corev1.EventTypeNormal, eventRotated, reasonSecretOverwritten, "replaced the value of existing Secret "+secret.Name)
+	r.recordGenerated(password, passwordHistory)
+	return "", nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+const (
+	reasonPolicyFetchFailed = "PolicyFetchFailed"
+	reasonWeakerThanPolicy  = "WeakerThanPolicy"
+)
+
+// generatorSpec returns the spec the value of password is generated and validated with:
+// the settings of the PasswordPolicy in spec.policyRef replace the settings of password.
+// The result is checked again against the bounds of the referenced PasswordPolicy and of the
+// default PasswordPolicy of the namespace, since they may have changed after the webhook admitted password.
+// It returns the reason of the Ready condition if it fails.
+func (r *PasswordReconciler) generatorSpec(ctx context.Context, password *secretv1alpha1.Password) (secretv1alpha1.PasswordSpec, string, error) {
+	spec := password.Spec
+	var policies []*secretv1alpha1.PasswordPolicy
+	if spec.PolicyRef != "" {
+		policy := &secretv1alpha1.PasswordPolicy{}
+		if err := r.Get(ctx, client.ObjectKey{Name: spec.PolicyRef}, policy); err != nil {
+			err = fmt.Errorf("PasswordPolicy %s: %w", spec.PolicyRef, err)
+			setCondition(password, secretv1alpha1.ConditionPolicySatisfied, metav1.ConditionFalse, reasonPolicyFetchFailed, err.Error())
+			return spec, reasonPolicyFetchFailed, err
+		}
+		policy.Spec.Apply(&spec)
+		policies = append(policies, policy)
+	}
+	defaultPolicy, err := secretv1alpha1.NamespaceDefaultPolicy(ctx, r.Client, password.Namespace)
+	if err != nil {
+		setCondition(password, secretv1alpha1.ConditionPolicySatisfied, metav1.ConditionFalse, reasonPolicyFetchFailed, err.Error())
+		return spec, reasonPolicyFetchFailed, err
+	}
+	if defaultPolicy != nil {
+		policies = append(policies, defaultPolicy)
+	}
+
+	// 基準を満たさない値は生成しない（PasswordPolicyが変更されると再度Reconcileされる）
+	for _, policy := range policies {
+		if err := policy.Spec.Check(spec); err != nil {
+			err = fmt.Errorf("PasswordPolicy %s: %w", policy.Name, err)
+			setCondition(password, secretv1alpha1.ConditionPolicySatisfied, metav1.ConditionFalse, reasonWeakerThanPolicy, err.Error())
+			return spec, reasonWeakerThanPolicy, err
+		}
+	}
+	return spec, "", nil
+}
+
+// passwordsForPolicy maps a PasswordPolicy to the Passwords referring to it with spec.policyRef
+// and the Passwords of the namespaces using it as their default policy.
+func (r *PasswordReconciler) passwordsForPolicy(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	var passwords secretv1alpha1.PasswordList
+	if err := r.List(ctx, &passwords); err != nil {
+		return nil
+	}
+	var namespaces corev1.NamespaceList
+	if err := r.List(ctx, &namespaces, client.MatchingLabels{secretv1alpha1.PolicyNamespaceLabel: obj.GetName()}); err != nil {
+		return nil
+	}
+	defaultFor := map[string]bool{}
+	for _, ns := range namespaces.Items {
+		defaultFor[ns.Name] = true
+	}
+
+	var requests []reconcile.Request
+	for _, password := range passwords.Items {
+		if password.Spec.PolicyRef == obj.GetName() || defaultFor[password.Namespace] {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&password)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+	"example.com/password-operator/internal/store"
+)
+
+// Reasons of the Pushed condition.
+const (
+	reasonPushed              = "Pushed"
+	reasonPushFailed          = "PushFailed"
+	reasonSecretStoreNotFound = "SecretStoreNotFound"
+)
+
+// pushSecret writes the data of secret to the store referenced by spec.pushTo
+// and records the result in the Pushed condition.
+// Nothing is pushed if the same version of the Secret was already pushed for the current generation.
+func (r *PasswordReconciler) pushSecret(ctx context.Context, password *secretv1alpha1.Password, secret *corev1.Secret) error {
+	spec := password.Spec.PushTo
+	if spec == nil {
+		meta.RemoveStatusCondition(&password.Status.Conditions, secretv1alpha1.ConditionPushed)
+		password.Status.PushedSecretVersion = ""
+		return nil
+	}
+	if meta.IsStatusConditionTrue(password.Status.Conditions, secretv1alpha1.ConditionPushed) &&
+		meta.FindStatusCondition(password.Status.Conditions, secretv1alpha1.ConditionPushed).ObservedGeneration == password.Generation &&
+		password.Status.PushedSecretVersion == secret.ResourceVersion {
+		return nil
+	}
+
+	var secretStore secretv1alpha1.SecretStore
+	if err := r.Get(ctx, types.NamespacedName{Namespace: password.Namespace, Name: spec.SecretStoreRef}, &secretStore); err != nil {
+		setPushedCondition(password, metav1.ConditionFalse, reasonSecretStoreNotFound, err.Error())
+		return err
+	}
+	newBackend := r.NewBackend
+	if newBackend == nil {
+		newBackend = store.NewBackend
+	}
+	backend, err := newBackend(ctx, r.Client, &secretStore)
+	if err != nil {
+		setPushedCondition(password, metav1.ConditionFalse, reasonPushFailed, err.Error())
+		return err
+	}
+	// 失敗した場合はエラーを返し、コントローラーのrate limiterによるバックオフで再度Reconcileする
+	if err := backend.Push(ctx, spec.Key, secret.Data); err != nil {
+		setPushedCondition(password, metav1.ConditionFalse, reasonPushFailed, err.Error())
+		return err
+	}
+
+	setPushedCondition(password, metav1.ConditionTrue, reasonPushed, "pushed to SecretStore "+secretStore.Name+" at "+spec.Key)
+	password.Status.PushedSecretVersion = secret.ResourceVersion
+	return nil
+}
+
+func setPushedCondition(password *secretv1alpha1.Password, status metav1.ConditionStatus, reason, message string) {
+	setCondition(password, secretv1alpha1.ConditionPushed, status, reason, message)
+}
+
+// passwordsForSecretStore maps a SecretStore to the Passwords pushing to it.
+func (r *PasswordReconciler) passwordsForSecretStore(obj client.Object) []reconcile.Request {
+	var passwords secretv1alpha1.PasswordList
+	if err := r.List(context.Background(), &passwords, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, password := range passwords.Items {
+		if password.Spec.PushTo == nil || password.Spec.PushTo.SecretStoreRef != obj.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&password)})
+	}
+	return requests
+}
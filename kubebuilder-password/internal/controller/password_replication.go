@@ -0,0 +1,214 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+const (
+	// replicationFinalizer removes the copies of the Secret before the Password is deleted.
+	// Owner references can't cross namespaces, so the copies are not garbage collected.
+	replicationFinalizer = "secret.example.com/replication"
+
+	// sourceLabel holds a hash of the namespace and name of the Password on its copies, to list them.
+	// Names can be longer than the 63 characters allowed in a label value, so the full names
+	// are kept in the annotations pointing back to the Password.
+	sourceLabel               = "secret.example.com/source"
+	sourceNamespaceAnnotation = "secret.example.com/source-namespace"
+	sourceNameAnnotation      = "secret.example.com/source-name"
+)
+
+// replicaLabels returns the labels selecting the copies of the Secret of password.
+func replicaLabels(password *secretv1alpha1.Password) map[string]string {
+	sum := sha256.Sum224([]byte(password.Namespace + "/" + password.Name))
+	return map[string]string{sourceLabel: hex.EncodeToString(sum[:])}
+}
+
+// replicaAnnotations returns the annotations pointing from the copies of the Secret back to password.
+func replicaAnnotations(password *secretv1alpha1.Password) map[string]string {
+	return map[string]string{
+		sourceNamespaceAnnotation: password.Namespace,
+		sourceNameAnnotation:      password.Name,
+	}
+}
+
+// isReplicaOf reports whether replica is a copy of the Secret of password.
+func isReplicaOf(replica *corev1.Secret, password *secretv1alpha1.Password) bool {
+	return replica.Annotations[sourceNamespaceAnnotation] == password.Namespace &&
+		replica.Annotations[sourceNameAnnotation] == password.Name
+}
+
+// replicaNamespaces returns the namespaces selected by spec.replicateTo, sorted.
+func (r *PasswordReconciler) replicaNamespaces(ctx context.Context, password *secretv1alpha1.Password) ([]string, error) {
+	spec := password.Spec.ReplicateTo
+	if spec == nil {
+		return nil, nil
+	}
+
+	selected := map[string]bool{}
+	for _, ns := range spec.Namespaces {
+		selected[ns] = true
+	}
+	if spec.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(spec.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		var namespaces corev1.NamespaceList
+		if err := r.List(ctx, &namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, err
+		}
+		for _, ns := range namespaces.Items {
+			selected[ns.Name] = true
+		}
+	}
+	delete(selected, password.Namespace)
+
+	result := make([]string, 0, len(selected))
+	for ns := range selected {
+		result = append(result, ns)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// syncReplicas copies secret to the namespaces selected by spec.replicateTo and
+// deletes the copies in namespaces that are no longer selected.
+// It returns the sync state of every selected namespace and an error if any of them failed.
+func (r *PasswordReconciler) syncReplicas(ctx context.Context, password *secretv1alpha1.Password, secret *corev1.Secret) ([]secretv1alpha1.ReplicaStatus, error) {
+	namespaces, err := r.replicaNamespaces(ctx, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed error
+	statuses := make([]secretv1alpha1.ReplicaStatus, 0, len(namespaces))
+	selected := map[string]bool{}
+	for _, ns := range namespaces {
+		selected[ns] = true
+		status := secretv1alpha1.ReplicaStatus{Namespace: ns, State: secretv1alpha1.PasswordInSync}
+		if err := r.syncReplica(ctx, password, secret, ns); err != nil {
+			status.State = secretv1alpha1.PasswordFailed
+			status.Reason = err.Error()
+			failed = fmt.Errorf("failed to replicate Secret to namespace %s: %w", ns, err)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// spec.replicateToから外れたnamespaceのコピーを削除
+	var replicas corev1.SecretList
+	if err := r.List(ctx, &replicas, client.MatchingLabels(replicaLabels(password))); err != nil {
+		return statuses, err
+	}
+	for i := range replicas.Items {
+		replica := &replicas.Items[i]
+		if selected[replica.Namespace] || !isReplicaOf(replica, password) {
+			continue
+		}
+		if err := r.Delete(ctx, replica); client.IgnoreNotFound(err) != nil {
+			return statuses, err
+		}
+	}
+	return statuses, failed
+}
+
+// syncReplica creates or updates the copy of secret in namespace.
+func (r *PasswordReconciler) syncReplica(ctx context.Context, password *secretv1alpha1.Password, secret *corev1.Secret, namespace string) error {
+	var replica corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: secret.Name}, &replica)
+	if apierrors.IsNotFound(err) {
+		replica = corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        secret.Name,
+				Namespace:   namespace,
+				Labels:      replicaLabels(password),
+				Annotations: replicaAnnotations(password),
+			},
+			Type: secret.Type,
+			Data: secret.Data,
+		}
+		return r.Create(ctx, &replica)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 同名のSecretがコピーでない場合は上書きしない
+	if !isReplicaOf(&replica, password) {
+		return fmt.Errorf("Secret %s/%s already exists and is not a copy of this Password", namespace, secret.Name)
+	}
+	replica.Data = secret.Data
+	return r.Update(ctx, &replica)
+}
+
+// deleteReplicas deletes every copy of the Secret of password.
+func (r *PasswordReconciler) deleteReplicas(ctx context.Context, password *secretv1alpha1.Password) error {
+	var replicas corev1.SecretList
+	if err := r.List(ctx, &replicas, client.MatchingLabels(replicaLabels(password))); err != nil {
+		return err
+	}
+	for i := range replicas.Items {
+		if !isReplicaOf(&replicas.Items[i], password) {
+			continue
+		}
+		if err := r.Delete(ctx, &replicas.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// passwordForReplica maps a copy of a Secret to the Password it was copied from.
+func (r *PasswordReconciler) passwordForReplica(obj client.Object) []reconcile.Request {
+	annotations := obj.GetAnnotations()
+	namespace, name := annotations[sourceNamespaceAnnotation], annotations[sourceNameAnnotation]
+	if namespace == "" || name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}}
+}
+
+// passwordsForNamespace maps a Namespace to the Passwords replicating by namespace selector,
+// so that a new or relabeled namespace receives its copies.
+func (r *PasswordReconciler) passwordsForNamespace(obj client.Object) []reconcile.Request {
+	var passwords secretv1alpha1.PasswordList
+	if err := r.List(context.Background(), &passwords); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, password := range passwords.Items {
+		if password.Spec.ReplicateTo == nil || password.Spec.ReplicateTo.NamespaceSelector == nil {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&password)})
+	}
+	return requests
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+var _ = Describe("Replication", func() {
+	const sourceNamespace = "default"
+	var (
+		ctx        = context.Background()
+		reconciler *PasswordReconciler
+	)
+
+	// コピー先のnamespace（envtestではnamespaceは削除されないため、既に存在する場合はそのまま使う）
+	BeforeEach(func() {
+		reconciler = &PasswordReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+		for _, ns := range []*corev1.Namespace{
+			{ObjectMeta: metav1.ObjectMeta{Name: "replica-a"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "replica-b", Labels: map[string]string{"replicate": "true"}}},
+		} {
+			if err := k8sClient.Create(ctx, ns); !apierrors.IsAlreadyExists(err) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+	})
+
+	newReplicatedPassword := func(name string, spec *secretv1alpha1.ReplicationSpec) (*secretv1alpha1.Password, *corev1.Secret) {
+		password := &secretv1alpha1.Password{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: sourceNamespace},
+			Spec:       secretv1alpha1.PasswordSpec{Length: 20, ReplicateTo: spec},
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: sourceNamespace},
+			Data:       map[string][]byte{"password": []byte("first-value")},
+		}
+		DeferCleanup(func() {
+			Expect(reconciler.deleteReplicas(ctx, password)).To(Succeed())
+		})
+		return password, secret
+	}
+
+	replicaData := func(namespace, name string) func() map[string][]byte {
+		return func() map[string][]byte {
+			var replica corev1.Secret
+			if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &replica); err != nil {
+				return nil
+			}
+			return replica.Data
+		}
+	}
+
+	// 選択したnamespaceにコピーされ、値の変更が反映されることをテスト
+	It("should copy the Secret to the selected namespaces and keep it in sync", func() {
+		password, secret := newReplicatedPassword("replicated", &secretv1alpha1.ReplicationSpec{
+			Namespaces:        []string{"replica-a"},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"replicate": "true"}},
+		})
+
+		statuses, err := reconciler.syncReplicas(ctx, password, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statuses).To(Equal([]secretv1alpha1.ReplicaStatus{
+			{Namespace: "replica-a", State: secretv1alpha1.PasswordInSync},
+			{Namespace: "replica-b", State: secretv1alpha1.PasswordInSync},
+		}))
+		Expect(replicaData("replica-a", secret.Name)()).To(Equal(secret.Data))
+		Expect(replicaData("replica-b", secret.Name)()).To(Equal(secret.Data))
+
+		secret.Data = map[string][]byte{"password": []byte("second-value")}
+		_, err = reconciler.syncReplicas(ctx, password, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replicaData("replica-a", secret.Name)()).To(Equal(secret.Data))
+		Expect(replicaData("replica-b", secret.Name)()).To(Equal(secret.Data))
+	})
+
+	// spec.replicateToから外したnamespaceのコピーと、Password削除時のコピーが削除されることをテスト
+	It("should delete the copies of deselected namespaces", func() {
+		password, secret := newReplicatedPassword("deselected", &secretv1alpha1.ReplicationSpec{Namespaces: []string{"replica-a", "replica-b"}})
+		_, err := reconciler.syncReplicas(ctx, password, secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		password.Spec.ReplicateTo.Namespaces = []string{"replica-b"}
+		_, err = reconciler.syncReplicas(ctx, password, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replicaData("replica-a", secret.Name)()).To(BeNil())
+		Expect(replicaData("replica-b", secret.Name)()).To(Equal(secret.Data))
+
+		Expect(reconciler.deleteReplicas(ctx, password)).To(Succeed())
+		Expect(replicaData("replica-b", secret.Name)()).To(BeNil())
+	})
+
+	// コピーではない同名のSecretが上書きされないことをテスト
+	It("should not overwrite a Secret that is not a copy", func() {
+		existing := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "not-a-copy", Namespace: "replica-a"},
+			Data:       map[string][]byte{"password": []byte("existing")},
+		}
+		Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, existing))).To(Succeed())
+		})
+
+		password, secret := newReplicatedPassword(existing.Name, &secretv1alpha1.ReplicationSpec{Namespaces: []string{"replica-a"}})
+		statuses, err := reconciler.syncReplicas(ctx, password, secret)
+		Expect(err).To(HaveOccurred())
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].State).To(Equal(secretv1alpha1.PasswordFailed))
+		Expect(replicaData("replica-a", existing.Name)()).To(Equal(existing.Data))
+
+		// Password削除時にも削除されない
+		Expect(reconciler.deleteReplicas(ctx, password)).To(Succeed())
+		Expect(replicaData("replica-a", existing.Name)()).To(Equal(existing.Data))
+	})
+})
@@ -0,0 +1,137 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+const (
+	// retentionFinalizer keeps the Password until its Secret was orphaned (Retain)
+	// or spec.deletionDelay has passed (Delete).
+	retentionFinalizer = "secret.example.com/retention"
+
+	// Reasons of the events recorded while a Password is deleted.
+	reasonDeletionDelayed = "DeletionDelayed"
+	reasonSecretRetained  = "SecretRetained"
+)
+
+// needsRetentionFinalizer reports whether the deletion of the Secret of password must be handled by the controller.
+func needsRetentionFinalizer(password *secretv1alpha1.Password) bool {
+	return password.Spec.RetainPolicy == secretv1alpha1.RetainPolicyRetain || password.Spec.DeletionDelay != nil
+}
+
+// finalize runs the finalizers of a Password being deleted.
+// The Secret is orphaned on Retain, or kept until spec.deletionDelay has passed on Delete.
+// The copies made for spec.replicateTo follow the same policy.
+func (r *PasswordReconciler) finalize(ctx context.Context, password *secretv1alpha1.Password) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	if !controllerutil.ContainsFinalizer(password, retentionFinalizer) && !controllerutil.ContainsFinalizer(password, replicationFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	retain := password.Spec.RetainPolicy == secretv1alpha1.RetainPolicyRetain
+
+	if controllerutil.ContainsFinalizer(password, retentionFinalizer) {
+		if retain {
+			if err := r.orphanDependents(ctx, password); err != nil {
+				logger.Error(err, "Orphan dependents - failed")
+				return ctrl.Result{}, err
+			}
+			r.recordEvent(ctx, password, nil, corev1.EventTypeNormal, eventRetained, reasonSecretRetained,
+				fmt.Sprintf("Secret %s is retained after the Password is deleted", password.Name))
+		} else if password.Spec.DeletionDelay != nil {
+			deleteAt := password.DeletionTimestamp.Add(password.Spec.DeletionDelay.Duration)
+			if remaining := time.Until(deleteAt); remaining > 0 {
+				r.recordEvent(ctx, password, nil, corev1.EventTypeWarning, eventDeletionDelayed, reasonDeletionDelayed,
+					fmt.Sprintf("Secret %s will be deleted at %s; set spec.retainPolicy to Retain to keep it", password.Name, deleteAt.UTC().Format(time.RFC3339)))
+				return ctrl.Result{RequeueAfter: remaining}, nil
+			}
+		}
+		controllerutil.RemoveFinalizer(password, retentionFinalizer)
+	}
+
+	// 他のnamespaceにコピーしたSecretはRetainの場合は残し、それ以外の場合は削除する
+	if controllerutil.ContainsFinalizer(password, replicationFinalizer) {
+		if !retain {
+			if err := r.deleteReplicas(ctx, password); err != nil {
+				logger.Error(err, "Delete replicated Secrets - failed")
+				return ctrl.Result{}, err
+			}
+		}
+		controllerutil.RemoveFinalizer(password, replicationFinalizer)
+	}
+
+	if err := r.Update(ctx, password); err != nil {
+		logger.Error(err, "Remove finalizer - failed")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// orphanDependents removes the owner references to password from its Secret, history Secret
+// and sealed ConfigMap so that they are not garbage collected with it.
+func (r *PasswordReconciler) orphanDependents(ctx context.Context, password *secretv1alpha1.Password) error {
+	dependents := []struct {
+		kind string
+		key  client.ObjectKey
+		obj  client.Object
+	}{
+		{kind: "Secret", key: client.ObjectKeyFromObject(password), obj: &corev1.Secret{}},
+		{kind: "Secret", key: historySecretName(password), obj: &corev1.Secret{}},
+		{kind: "ConfigMap", key: sealedConfigMapName(password), obj: &corev1.ConfigMap{}},
+	}
+	for _, dependent := range dependents {
+		if err := r.Get(ctx, dependent.key, dependent.obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		refs := removeOwnerReference(dependent.obj.GetOwnerReferences(), password)
+		if len(refs) == len(dependent.obj.GetOwnerReferences()) {
+			continue
+		}
+		dependent.obj.SetOwnerReferences(refs)
+		if err := r.Update(ctx, dependent.obj); err != nil {
+			return fmt.Errorf("failed to orphan %s %s: %w", dependent.kind, dependent.key.Name, err)
+		}
+	}
+	return nil
+}
+
+func removeOwnerReference(refs []metav1.OwnerReference, owner client.Object) []metav1.OwnerReference {
+	result := make([]metav1.OwnerReference, 0, len(refs))
+	for _, ref := range refs {
+		if ref.UID == owner.GetUID() {
+			continue
+		}
+		result = append(result, ref)
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+var _ = Describe("Retention", func() {
+	var (
+		ctx        = context.Background()
+		reconciler *PasswordReconciler
+	)
+
+	BeforeEach(func() {
+		reconciler = &PasswordReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	// Passwordを参照するownerReferenceを持つSecretを作成する
+	newOwnedSecret := func(password *secretv1alpha1.Password, key types.NamespacedName) *corev1.Secret {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: secretv1alpha1.GroupVersion.String(),
+					Kind:       "Password",
+					Name:       password.Name,
+					UID:        password.UID,
+				}},
+			},
+			Data: map[string][]byte{"password": []byte("retained")},
+		}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, secret))).To(Succeed())
+		})
+		return secret
+	}
+
+	// Retainの場合にSecretとhistory SecretのownerReferenceが外れることをテスト
+	It("should orphan the Secret and the history Secret", func() {
+		password := &secretv1alpha1.Password{
+			ObjectMeta: metav1.ObjectMeta{Name: "retained", Namespace: "default", UID: "retained-uid"},
+			Spec:       secretv1alpha1.PasswordSpec{Length: 20, RetainPolicy: secretv1alpha1.RetainPolicyRetain},
+		}
+		secret := newOwnedSecret(password, client.ObjectKeyFromObject(password))
+		history := newOwnedSecret(password, historySecretName(password))
+
+		Expect(reconciler.orphanDependents(ctx, password)).To(Succeed())
+		for _, obj := range []*corev1.Secret{secret, history} {
+			var got corev1.Secret
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), &got)).To(Succeed())
+			Expect(got.OwnerReferences).To(BeEmpty())
+			Expect(got.Data).To(Equal(obj.Data))
+		}
+	})
+
+	// spec.deletionDelayが経過するまでfinalizerが外れないことをテスト
+	It("should keep the finalizer until the deletion delay has passed", func() {
+		now := metav1.Now()
+		password := &secretv1alpha1.Password{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "delayed",
+				Namespace:         "default",
+				DeletionTimestamp: &now,
+				Finalizers:        []string{retentionFinalizer},
+			},
+			Spec: secretv1alpha1.PasswordSpec{Length: 20, DeletionDelay: &metav1.Duration{Duration: time.Hour}},
+		}
+
+		result, err := reconciler.finalize(ctx, password)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+		Expect(password.Finalizers).To(ConsistOf(retentionFinalizer))
+	})
+})
@@ -0,0 +1,219 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+const (
+	// secretHashAnnotation on the pod template of a rollout target holds the hash of the Secret
+	// its pods were started with. Changing it restarts the pods.
+	secretHashAnnotation = "secret.example.com/secret-hash"
+
+	reasonRolloutFailed = "RolloutFailed"
+	reasonRolledOut     = "RolledOut"
+)
+
+// secretHash returns a hash identifying the version of a Secret.
+// It is written to the pod templates and the status, which are readable by more users
+// than the Secret, so it is computed from the UID and resourceVersion instead of the data.
+// The controller only updates the Secret to change its value or to adopt it.
+func secretHash(secret *corev1.Secret) string {
+	h := sha256.Sum256([]byte(string(secret.UID) + "/" + secret.ResourceVersion))
+	return hex.EncodeToString(h[:])
+}
+
+// rollout restarts the workloads selected by spec.rolloutTargets after the value of secret changed.
+// A workload seen for the first time only records the current hash as its baseline and is not
+// restarted, so adding a target does not restart workloads when no value was rotated.
+// It returns the state of every selected workload and an error if any of them failed.
+func (r *PasswordReconciler) rollout(ctx context.Context, password *secretv1alpha1.Password, secret *corev1.Secret) ([]secretv1alpha1.RolloutStatus, error) {
+	if len(password.Spec.RolloutTargets) == 0 {
+		return nil, nil
+	}
+	hash := secretHash(secret)
+
+	// 前回の再起動時刻を引き継ぐ
+	previous := map[string]secretv1alpha1.RolloutStatus{}
+	for _, status := range password.Status.Rollouts {
+		previous[rolloutKey(status.Kind, status.Namespace, status.Name)] = status
+	}
+
+	var failed error
+	var statuses []secretv1alpha1.RolloutStatus
+	seen := map[string]bool{}
+	for _, target := range password.Spec.RolloutTargets {
+		workloads, err := r.rolloutWorkloads(ctx, password, target)
+		if err != nil {
+			failed = fmt.Errorf("failed to list %s rollout targets: %w", target.Kind, err)
+			// 一覧を取得できなかったワークロードの基準のハッシュを失わないように、前回の状態を残す
+			namespace := password.Spec.RolloutNamespace(password.Namespace, target)
+			for key, status := range previous {
+				if status.Kind == target.Kind && status.Namespace == namespace && !seen[key] {
+					seen[key] = true
+					statuses = append(statuses, status)
+				}
+			}
+			continue
+		}
+		for _, workload := range workloads {
+			key := rolloutKey(target.Kind, workload.GetNamespace(), workload.GetName())
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			status, ok := previous[key]
+			if !ok || status.SecretHash == "" {
+				// 初めて選択されたワークロードは現在のハッシュを基準として記録するだけで、再起動しない
+				statuses = append(statuses, secretv1alpha1.RolloutStatus{Kind: target.Kind, Namespace: workload.GetNamespace(), Name: workload.GetName(), SecretHash: hash})
+				continue
+			}
+			if status.SecretHash == hash {
+				statuses = append(statuses, status)
+				continue
+			}
+			// 前回記録したハッシュから値が変わった場合だけ再起動する
+			restarted, err := r.restartWorkload(ctx, workload, hash)
+			if err != nil {
+				failed = fmt.Errorf("failed to restart %s %s/%s: %w", target.Kind, workload.GetNamespace(), workload.GetName(), err)
+			} else {
+				status.SecretHash = hash
+				if restarted {
+					now := metav1.Now()
+					status.RestartedAt = &now
+					r.recordEvent(ctx, password, secret, corev1.EventTypeNormal, eventRolledOut, reasonRolledOut,
+						fmt.Sprintf("Restarted %s %s/%s", target.Kind, workload.GetNamespace(), workload.GetName()))
+				}
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return rolloutKey(statuses[i].Kind, statuses[i].Namespace, statuses[i].Name) <
+			rolloutKey(statuses[j].Kind, statuses[j].Namespace, statuses[j].Name)
+	})
+	return statuses, failed
+}
+
+func rolloutKey(kind secretv1alpha1.RolloutKind, namespace, name string) string {
+	return string(kind) + "/" + namespace + "/" + name
+}
+
+// rolloutWorkloads returns the workloads selected by target.
+// A workload selected by name that does not exist is skipped.
+func (r *PasswordReconciler) rolloutWorkloads(ctx context.Context, password *secretv1alpha1.Password, target secretv1alpha1.RolloutTarget) ([]client.Object, error) {
+	// webhookを通さずに作成されたPasswordでも、他のnamespaceのワークロードは変更しない
+	namespace := password.Spec.RolloutNamespace(password.Namespace, target)
+	if !password.Spec.RolloutNamespaceAllowed(password.Namespace, namespace) {
+		return nil, fmt.Errorf("%w: %s", secretv1alpha1.ErrRolloutTargetNamespace, namespace)
+	}
+
+	if target.Name != "" {
+		var workload client.Object
+		switch target.Kind {
+		case secretv1alpha1.RolloutKindDeployment:
+			workload = &appsv1.Deployment{}
+		case secretv1alpha1.RolloutKindStatefulSet:
+			workload = &appsv1.StatefulSet{}
+		default:
+			return nil, fmt.Errorf("unknown rollout target kind %q", target.Kind)
+		}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: target.Name}, workload); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return []client.Object{workload}, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(target.Selector)
+	if err != nil {
+		return nil, err
+	}
+	opts := []client.ListOption{client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}}
+	var workloads []client.Object
+	switch target.Kind {
+	case secretv1alpha1.RolloutKindDeployment:
+		var list appsv1.DeploymentList
+		if err := r.List(ctx, &list, opts...); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			workloads = append(workloads, &list.Items[i])
+		}
+	case secretv1alpha1.RolloutKindStatefulSet:
+		var list appsv1.StatefulSetList
+		if err := r.List(ctx, &list, opts...); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			workloads = append(workloads, &list.Items[i])
+		}
+	default:
+		return nil, fmt.Errorf("unknown rollout target kind %q", target.Kind)
+	}
+	return workloads, nil
+}
+
+// restartWorkload writes hash to the pod template of workload, which rolls out new pods.
+// It reports whether the workload was restarted.
+func (r *PasswordReconciler) restartWorkload(ctx context.Context, workload client.Object, hash string) (bool, error) {
+	template := podTemplate(workload)
+	if template == nil {
+		return false, fmt.Errorf("unsupported workload %T", workload)
+	}
+	if template.Annotations[secretHashAnnotation] == hash {
+		return false, nil
+	}
+
+	patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[secretHashAnnotation] = hash
+	if err := r.Patch(ctx, workload, patch); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func podTemplate(workload client.Object) *corev1.PodTemplateSpec {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+	"example.com/password-operator/pkg/seal"
+)
+
+const (
+	// sealedConfigMapSuffix is appended to the Password name to name the ConfigMap holding the sealed values.
+	sealedConfigMapSuffix = "-sealed"
+
+	// Annotations on the sealed ConfigMap recording what was sealed, so that the values
+	// are only sealed again when the Secret or the public key changes.
+	sealedSecretVersionAnnotation  = "secret.example.com/sealed-secret-version"
+	sealedKeyFingerprintAnnotation = "secret.example.com/sealed-key-fingerprint"
+
+	reasonSealFailed = "SealFailed"
+)
+
+func sealedConfigMapName(password *secretv1alpha1.Password) types.NamespacedName {
+	return types.NamespacedName{Namespace: password.Namespace, Name: password.Name + sealedConfigMapSuffix}
+}
+
+// sealSecret writes every value of secret, sealed with the public key of spec.encryption,
+// to the sealed ConfigMap of password. The key of the Secret is used as associated data.
+// The ConfigMap is deleted when spec.encryption is removed.
+func (r *PasswordReconciler) sealSecret(ctx context.Context, password *secretv1alpha1.Password, secret *corev1.Secret) error {
+	key := sealedConfigMapName(password)
+	var configMap corev1.ConfigMap
+	err := r.Get(ctx, key, &configMap)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	spec := password.Spec.Encryption
+	if spec == nil {
+		password.Status.SealedRef = nil
+		if exists && metav1.IsControlledBy(&configMap, password) {
+			return client.IgnoreNotFound(r.Delete(ctx, &configMap))
+		}
+		return nil
+	}
+
+	var publicKey corev1.ConfigMap
+	if err := r.Get(ctx, types.NamespacedName{Namespace: password.Namespace, Name: spec.PublicKeyRef.Name}, &publicKey); err != nil {
+		return fmt.Errorf("failed to fetch public key: %w", err)
+	}
+	recipient, err := seal.ParseRecipient([]byte(publicKey.Data[spec.PublicKeyRef.Key]))
+	if err != nil {
+		return fmt.Errorf("failed to parse public key %s/%s: %w", spec.PublicKeyRef.Name, spec.PublicKeyRef.Key, err)
+	}
+
+	if exists {
+		if !metav1.IsControlledBy(&configMap, password) {
+			return fmt.Errorf("ConfigMap %s already exists and is not owned by this Password", key.Name)
+		}
+		// 暗号化は毎回異なる結果になるため、Secretか公開鍵が変わった場合のみ暗号化し直す
+		if configMap.Annotations[sealedSecretVersionAnnotation] == secret.ResourceVersion &&
+			configMap.Annotations[sealedKeyFingerprintAnnotation] == recipient.Fingerprint() {
+			password.Status.SealedRef = &corev1.LocalObjectReference{Name: key.Name}
+			return nil
+		}
+	} else {
+		configMap = corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+			},
+		}
+		if err := ctrl.SetControllerReference(password, &configMap, r.Scheme); err != nil {
+			return err
+		}
+	}
+
+	configMap.Data = make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		envelope, err := recipient.Seal(v, []byte(k))
+		if err != nil {
+			return err
+		}
+		encoded, err := envelope.Marshal()
+		if err != nil {
+			return err
+		}
+		configMap.Data[k] = string(encoded)
+	}
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	configMap.Annotations[sealedSecretVersionAnnotation] = secret.ResourceVersion
+	configMap.Annotations[sealedKeyFingerprintAnnotation] = recipient.Fingerprint()
+
+	if exists {
+		err = r.Update(ctx, &configMap)
+	} else {
+		err = r.Create(ctx, &configMap)
+	}
+	if err != nil {
+		return err
+	}
+	password.Status.SealedRef = &corev1.LocalObjectReference{Name: key.Name}
+	return nil
+}
+
+// passwordsForPublicKey maps a ConfigMap to the Passwords sealing their values with a key in it.
+func (r *PasswordReconciler) passwordsForPublicKey(obj client.Object) []reconcile.Request {
+	var passwords secretv1alpha1.PasswordList
+	if err := r.List(context.Background(), &passwords, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, password := range passwords.Items {
+		if password.Spec.Encryption == nil || password.Spec.Encryption.PublicKeyRef.Name != obj.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&password)})
+	}
+	return requests
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+// Reasons of the Ready, SecretCreated, Rotated and PolicySatisfied conditions.
+const (
+	reasonReconciled           = "Reconciled"
+	reasonHistoryFetchFailed   = "HistoryFetchFailed"
+	reasonHistoryRecordFailed  = "HistoryRecordFailed"
+	reasonHistoryTrimFailed    = "HistoryTrimFailed"
+	reasonGenerateFailed       = "GenerateFailed"
+	reasonOwnerReferenceFailed = "OwnerReferenceFailed"
+	reasonSecretCreated        = "Created"
+	reasonSecretCreateFailed   = "CreateFailed"
+	reasonSecretFound          = "Found"
+	reasonSecretFetchFailed    = "FetchFailed"
+	reasonReplicationFailed    = "ReplicationFailed"
+	reasonGenerated            = "Generated"
+	reasonPolicySatisfied      = "Satisfied"
+)
+
+func setCondition(password *secretv1alpha1.Password, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&password.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: password.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// patchStatus writes the status of password with a merge patch against original,
+// so that it does not conflict with concurrent updates of the object.
+func (r *PasswordReconciler) patchStatus(ctx context.Context, password, original *secretv1alpha1.Password) error {
+	password.Status.ObservedGeneration = password.Generation
+	return r.Status().Patch(ctx, password, client.MergeFrom(original))
+}
+
+// fail records err in the Ready condition and a Warning event, and patches the status.
+// err is returned so that the request is retried with backoff.
+func (r *PasswordReconciler) fail(ctx context.Context, password, original *secretv1alpha1.Password, reason string, err error) (ctrl.Result, error) {
+	setCondition(password, secretv1alpha1.ConditionReady, metav1.ConditionFalse, reason, err.Error())
+	r.recordEvent(ctx, password, nil, corev1.EventTypeWarning, eventFailed, reason, reason+": "+err.Error())
+	if patchErr := r.patchStatus(ctx, password, original); patchErr != nil {
+		log.FromContext(ctx).Error(patchErr, "Failed to update Password status")
+		return ctrl.Result{}, patchErr
+	}
+	return ctrl.Result{}, err
+}
+
+// stall records err like fail, but does not return it: retrying can't succeed
+// until the Password is changed, which triggers a new reconcile.
+func (r *PasswordReconciler) stall(ctx context.Context, password, original *secretv1alpha1.Password, reason string, err error) (ctrl.Result, error) {
+	if _, patchErr := r.fail(ctx, password, original, reason, err); patchErr != err {
+		return ctrl.Result{}, patchErr
+	}
+	return ctrl.Result{}, nil
+}
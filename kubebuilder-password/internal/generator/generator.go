@@ -0,0 +1,64 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package generator produces the data stored in the Secret owned by a Password.
+package generator
+
+import (
+	"fmt"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+// Keys of the Secret data written by the generators.
+const (
+	// PasswordKey holds the value of the single-value generators (Password, Passphrase, Hex, Base64, UUID).
+	PasswordKey = "password"
+	// PrivateKeyKey holds the private key of the keypair generators.
+	PrivateKeyKey = "privateKey"
+	// PublicKeyKey holds the public key of the keypair generators.
+	PublicKeyKey = "publicKey"
+)
+
+// Generator generates the data of a Secret.
+type Generator interface {
+	Generate() (map[string][]byte, error)
+	// Validate checks that data, e.g. of an existing Secret, satisfies the options of the Generator.
+	// It returns an error wrapping ErrPolicyNotSatisfied if it does not.
+	Validate(data map[string][]byte) error
+}
+
+// New returns the Generator selected by spec.generator.
+// An empty generator falls back to Password so that objects created before
+// spec.generator existed keep their behaviour.
+func New(spec secretv1alpha1.PasswordSpec) (Generator, error) {
+	switch spec.Generator {
+	case "", secretv1alpha1.GeneratorPassword:
+		return newRandomGenerator(spec), nil
+	case secretv1alpha1.GeneratorPassphrase:
+		return newPassphraseGenerator(spec.Passphrase), nil
+	case secretv1alpha1.GeneratorHex:
+		return newTokenGenerator(spec.Token, hexEncoding), nil
+	case secretv1alpha1.GeneratorBase64:
+		return newTokenGenerator(spec.Token, base64Encoding), nil
+	case secretv1alpha1.GeneratorUUID:
+		return &uuidGenerator{}, nil
+	case secretv1alpha1.GeneratorRSA, secretv1alpha1.GeneratorECDSA, secretv1alpha1.GeneratorEd25519:
+		return newKeyPairGenerator(spec.Generator, spec.KeyPair)
+	default:
+		return nil, fmt.Errorf("unknown generator %q", spec.Generator)
+	}
+}
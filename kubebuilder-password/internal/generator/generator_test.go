@@ -0,0 +1,232 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+func generate(spec secretv1alpha1.PasswordSpec) map[string][]byte {
+	g, err := New(spec)
+	Expect(err).NotTo(HaveOccurred())
+	data, err := g.Generate()
+	Expect(err).NotTo(HaveOccurred())
+	return data
+}
+
+var _ = Describe("Generator", func() {
+	Context("Password", func() {
+		It("should honour length and digit count", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Generator: secretv1alpha1.GeneratorPassword,
+				Length:    24,
+				Digit:     5,
+				Symbol:    3,
+			})
+			password := string(data[PasswordKey])
+			Expect(password).To(HaveLen(24))
+			digits := 0
+			for _, c := range password {
+				if unicode.IsDigit(c) {
+					digits++
+				}
+			}
+			Expect(digits).To(Equal(5))
+		})
+
+		// spec.generatorが未指定の既存オブジェクトはPasswordとして扱う
+		It("should be used when generator is empty", func() {
+			g, err := New(secretv1alpha1.PasswordSpec{Length: 20})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(g).To(BeAssignableToTypeOf(&randomGenerator{}))
+		})
+
+		It("should fail when digits and symbols exceed length", func() {
+			g, err := New(secretv1alpha1.PasswordSpec{Length: 8, Digit: 5, Symbol: 5})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = g.Generate()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Password character sets", func() {
+		It("should never use excluded characters", func() {
+			for i := 0; i < 20; i++ {
+				data := generate(secretv1alpha1.PasswordSpec{
+					Length:            64,
+					Digit:             20,
+					Symbol:            10,
+					ExcludeCharacters: "0O1lI",
+				})
+				Expect(strings.ContainsAny(string(data[PasswordKey]), "0O1lI")).To(BeFalse())
+			}
+		})
+
+		It("should only use allowed symbols", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Length:         40,
+				Symbol:         20,
+				AllowedSymbols: "-_.",
+			})
+			password := string(data[PasswordKey])
+			Expect(password).To(HaveLen(40))
+			for _, c := range password {
+				if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+					Expect("-_.").To(ContainSubstring(string(c)))
+				}
+			}
+		})
+
+		It("should honour minimum lower and upper case letters", func() {
+			for i := 0; i < 20; i++ {
+				data := generate(secretv1alpha1.PasswordSpec{
+					Length:   20,
+					Digit:    4,
+					Symbol:   4,
+					MinLower: 6,
+					MinUpper: 6,
+					// 小文字を2文字だけ残しても最低文字数を満たせること
+					ExcludeCharacters: "abcdefghijklmnopqrstuvwx",
+				})
+				lower, upper := 0, 0
+				for _, c := range string(data[PasswordKey]) {
+					switch {
+					case unicode.IsLower(c):
+						lower++
+					case unicode.IsUpper(c):
+						upper++
+					}
+				}
+				Expect(lower).To(Equal(6))
+				Expect(upper).To(Equal(6))
+			}
+		})
+
+		It("should not repeat characters when disallowRepeat is set", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Length:         30,
+				Digit:          5,
+				Symbol:         5,
+				MinLower:       10,
+				MinUpper:       10,
+				DisallowRepeat: true,
+			})
+			password := string(data[PasswordKey])
+			for _, c := range password {
+				Expect(strings.Count(password, string(c))).To(Equal(1))
+			}
+		})
+
+		It("should fail when all digits are excluded", func() {
+			g, err := New(secretv1alpha1.PasswordSpec{Length: 20, Digit: 2, ExcludeCharacters: "0123456789"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = g.Generate()
+			Expect(err).To(MatchError(ErrNoCharactersAvailable))
+		})
+
+		It("should fail when the minimum letters exceed the number of letters", func() {
+			g, err := New(secretv1alpha1.PasswordSpec{Length: 10, Digit: 4, Symbol: 4, MinLower: 2, MinUpper: 1})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = g.Generate()
+			Expect(err).To(MatchError(ErrMinLettersExceedLetters))
+		})
+	})
+
+	Context("Passphrase", func() {
+		It("should join words from the wordlist with the separator", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Generator:  secretv1alpha1.GeneratorPassphrase,
+				Passphrase: &secretv1alpha1.PassphraseSpec{Words: 8, Separator: "."},
+			})
+			words := strings.Split(string(data[PasswordKey]), ".")
+			Expect(words).To(HaveLen(8))
+			for _, w := range words {
+				Expect(wordlist).To(ContainElement(w))
+			}
+		})
+
+		It("should default to six words separated by hyphens", func() {
+			data := generate(secretv1alpha1.PasswordSpec{Generator: secretv1alpha1.GeneratorPassphrase})
+			Expect(strings.Split(string(data[PasswordKey]), "-")).To(HaveLen(defaultPassphraseWords))
+		})
+
+		It("should embed a wordlist without duplicates", func() {
+			seen := map[string]bool{}
+			for _, w := range wordlist {
+				Expect(seen).NotTo(HaveKey(w))
+				seen[w] = true
+			}
+			Expect(len(wordlist)).To(BeNumerically(">=", 1024))
+			// PasswordPolicyはこの単語数でエントロピーを見積もる
+			Expect(wordlist).To(HaveLen(secretv1alpha1.PassphraseWordlistSize))
+		})
+	})
+
+	Context("Hex", func() {
+		It("should encode the requested number of bytes", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Generator: secretv1alpha1.GeneratorHex,
+				Token:     &secretv1alpha1.TokenSpec{Bytes: 16},
+			})
+			raw, err := hex.DecodeString(string(data[PasswordKey]))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(raw).To(HaveLen(16))
+		})
+	})
+
+	Context("Base64", func() {
+		It("should encode the requested number of bytes", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Generator: secretv1alpha1.GeneratorBase64,
+				Token:     &secretv1alpha1.TokenSpec{Bytes: 48},
+			})
+			raw, err := base64.StdEncoding.DecodeString(string(data[PasswordKey]))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(raw).To(HaveLen(48))
+		})
+
+		It("should default to 32 bytes", func() {
+			data := generate(secretv1alpha1.PasswordSpec{Generator: secretv1alpha1.GeneratorBase64})
+			raw, err := base64.StdEncoding.DecodeString(string(data[PasswordKey]))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(raw).To(HaveLen(defaultTokenBytes))
+		})
+	})
+
+	Context("UUID", func() {
+		It("should generate a version 4 UUID", func() {
+			data := generate(secretv1alpha1.PasswordSpec{Generator: secretv1alpha1.GeneratorUUID})
+			id, err := uuid.Parse(string(data[PasswordKey]))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id.Version()).To(Equal(uuid.Version(4)))
+		})
+	})
+
+	It("should reject an unknown generator", func() {
+		_, err := New(secretv1alpha1.PasswordSpec{Generator: "Unknown"})
+		Expect(err).To(HaveOccurred())
+	})
+})
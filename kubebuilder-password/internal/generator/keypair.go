@@ -0,0 +1,131 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+const (
+	defaultRSABits = 4096
+	defaultCurve   = "P256"
+)
+
+var curves = map[string]elliptic.Curve{
+	"P256": elliptic.P256(),
+	"P384": elliptic.P384(),
+	"P521": elliptic.P521(),
+}
+
+// keyPairGenerator generates an RSA, ECDSA or Ed25519 keypair.
+type keyPairGenerator struct {
+	keyType secretv1alpha1.GeneratorType
+	bits    int
+	curve   elliptic.Curve
+	format  secretv1alpha1.KeyFormat
+}
+
+func newKeyPairGenerator(keyType secretv1alpha1.GeneratorType, spec *secretv1alpha1.KeyPairSpec) (*keyPairGenerator, error) {
+	g := &keyPairGenerator{
+		keyType: keyType,
+		bits:    defaultRSABits,
+		curve:   curves[defaultCurve],
+		format:  secretv1alpha1.KeyFormatPEM,
+	}
+	if spec == nil {
+		return g, nil
+	}
+	if spec.Bits > 0 {
+		g.bits = spec.Bits
+	}
+	if spec.Curve != "" {
+		curve, ok := curves[spec.Curve]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q", spec.Curve)
+		}
+		g.curve = curve
+	}
+	switch spec.Format {
+	case "":
+	case secretv1alpha1.KeyFormatPEM, secretv1alpha1.KeyFormatOpenSSH:
+		g.format = spec.Format
+	default:
+		return nil, fmt.Errorf("unknown key format %q", spec.Format)
+	}
+	return g, nil
+}
+
+func (g *keyPairGenerator) Generate() (map[string][]byte, error) {
+	key, err := g.generateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var privateKey, publicKey []byte
+	switch g.format {
+	case secretv1alpha1.KeyFormatOpenSSH:
+		privateKey, publicKey, err = marshalOpenSSH(key)
+	default:
+		privateKey, publicKey, err = marshalPEM(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		PrivateKeyKey: privateKey,
+		PublicKeyKey:  publicKey,
+	}, nil
+}
+
+func (g *keyPairGenerator) generateKey() (crypto.Signer, error) {
+	switch g.keyType {
+	case secretv1alpha1.GeneratorRSA:
+		return rsa.GenerateKey(rand.Reader, g.bits)
+	case secretv1alpha1.GeneratorECDSA:
+		return ecdsa.GenerateKey(g.curve, rand.Reader)
+	case secretv1alpha1.GeneratorEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unknown key type %q", g.keyType)
+	}
+}
+
+// marshalPEM encodes the private key as PKCS#8 and the public key as PKIX.
+func marshalPEM(key crypto.Signer) ([]byte, []byte, error) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return privateKey, publicKey, nil
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+// sshReader reads values in the SSH wire encoding.
+type sshReader []byte
+
+func (r *sshReader) uint32() uint32 {
+	Expect(len(*r)).To(BeNumerically(">=", 4))
+	v := binary.BigEndian.Uint32(*r)
+	*r = (*r)[4:]
+	return v
+}
+
+func (r *sshReader) string() []byte {
+	n := r.uint32()
+	Expect(len(*r)).To(BeNumerically(">=", int(n)))
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v
+}
+
+func (r *sshReader) mpint() *big.Int {
+	return new(big.Int).SetBytes(r.string())
+}
+
+// parseOpenSSH decodes an unencrypted OpenSSH private key and returns the
+// public key blob and the type-specific private fields.
+func parseOpenSSH(data []byte) ([]byte, sshReader) {
+	block, _ := pem.Decode(data)
+	Expect(block).NotTo(BeNil())
+	Expect(block.Type).To(Equal("OPENSSH PRIVATE KEY"))
+	Expect(string(block.Bytes[:len(opensshMagic)])).To(Equal(opensshMagic))
+
+	r := sshReader(block.Bytes[len(opensshMagic):])
+	Expect(string(r.string())).To(Equal("none"))
+	Expect(string(r.string())).To(Equal("none"))
+	Expect(r.string()).To(BeEmpty())
+	Expect(r.uint32()).To(Equal(uint32(1)))
+	publicBlob := r.string()
+	private := sshReader(r.string())
+	Expect(r).To(BeEmpty())
+	Expect(len(private) % opensshBlockSize).To(Equal(0))
+
+	Expect(private.uint32()).To(Equal(private.uint32()))
+	return publicBlob, private
+}
+
+// parseAuthorizedKey decodes a public key in authorized_keys format.
+func parseAuthorizedKey(data []byte) (string, []byte) {
+	fields := strings.Fields(string(data))
+	Expect(fields).To(HaveLen(2))
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	Expect(err).NotTo(HaveOccurred())
+	return fields[0], blob
+}
+
+// expectSignable checks that the PEM encoded keys form a pair.
+func expectSignable(data map[string][]byte) crypto.PrivateKey {
+	privateBlock, _ := pem.Decode(data[PrivateKeyKey])
+	Expect(privateBlock).NotTo(BeNil())
+	Expect(privateBlock.Type).To(Equal("PRIVATE KEY"))
+	privateKey, err := x509.ParsePKCS8PrivateKey(privateBlock.Bytes)
+	Expect(err).NotTo(HaveOccurred())
+
+	publicBlock, _ := pem.Decode(data[PublicKeyKey])
+	Expect(publicBlock).NotTo(BeNil())
+	Expect(publicBlock.Type).To(Equal("PUBLIC KEY"))
+	publicKey, err := x509.ParsePKIXPublicKey(publicBlock.Bytes)
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(privateKey.(interface{ Public() crypto.PublicKey }).Public()).To(Equal(publicKey))
+	return privateKey
+}
+
+var _ = Describe("KeyPair generator", func() {
+	Context("PEM", func() {
+		It("should generate an RSA keypair of the requested size", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Generator: secretv1alpha1.GeneratorRSA,
+				KeyPair:   &secretv1alpha1.KeyPairSpec{Bits: 2048},
+			})
+			key := expectSignable(data).(*rsa.PrivateKey)
+			Expect(key.N.BitLen()).To(Equal(2048))
+		})
+
+		It("should generate an ECDSA keypair on the requested curve", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Generator: secretv1alpha1.GeneratorECDSA,
+				KeyPair:   &secretv1alpha1.KeyPairSpec{Curve: "P384"},
+			})
+			key := expectSignable(data).(*ecdsa.PrivateKey)
+			Expect(key.Curve).To(Equal(elliptic.P384()))
+
+			digest := sha256.Sum256([]byte("message"))
+			sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig)).To(BeTrue())
+		})
+
+		It("should generate an Ed25519 keypair", func() {
+			data := generate(secretv1alpha1.PasswordSpec{Generator: secretv1alpha1.GeneratorEd25519})
+			key := expectSignable(data).(ed25519.PrivateKey)
+			sig := ed25519.Sign(key, []byte("message"))
+			Expect(ed25519.Verify(key.Public().(ed25519.PublicKey), []byte("message"), sig)).To(BeTrue())
+		})
+	})
+
+	Context("OpenSSH", func() {
+		It("should generate an RSA keypair", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Generator: secretv1alpha1.GeneratorRSA,
+				KeyPair:   &secretv1alpha1.KeyPairSpec{Bits: 2048, Format: secretv1alpha1.KeyFormatOpenSSH},
+			})
+			keyType, publicBlob := parseAuthorizedKey(data[PublicKeyKey])
+			Expect(keyType).To(Equal("ssh-rsa"))
+			embeddedBlob, private := parseOpenSSH(data[PrivateKeyKey])
+			Expect(embeddedBlob).To(Equal(publicBlob))
+
+			Expect(string(private.string())).To(Equal("ssh-rsa"))
+			n, e, d := private.mpint(), private.mpint(), private.mpint()
+			iqmp, p, q := private.mpint(), private.mpint(), private.mpint()
+			Expect(n.BitLen()).To(Equal(2048))
+			Expect(new(big.Int).Mul(p, q)).To(Equal(n))
+			Expect(new(big.Int).Mod(new(big.Int).Mul(iqmp, q), p).Int64()).To(Equal(int64(1)))
+
+			// 秘密鍵から復元した鍵で署名・検証できることを確認
+			key := &rsa.PrivateKey{
+				PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+				D:         d,
+				Primes:    []*big.Int{p, q},
+			}
+			Expect(key.Validate()).To(Succeed())
+
+			public := sshReader(publicBlob)
+			Expect(string(public.string())).To(Equal("ssh-rsa"))
+			Expect(public.mpint()).To(Equal(e))
+			Expect(public.mpint()).To(Equal(n))
+		})
+
+		It("should generate an ECDSA keypair", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Generator: secretv1alpha1.GeneratorECDSA,
+				KeyPair:   &secretv1alpha1.KeyPairSpec{Curve: "P521", Format: secretv1alpha1.KeyFormatOpenSSH},
+			})
+			keyType, publicBlob := parseAuthorizedKey(data[PublicKeyKey])
+			Expect(keyType).To(Equal("ecdsa-sha2-nistp521"))
+			embeddedBlob, private := parseOpenSSH(data[PrivateKeyKey])
+			Expect(embeddedBlob).To(Equal(publicBlob))
+
+			Expect(string(private.string())).To(Equal(keyType))
+			Expect(string(private.string())).To(Equal("nistp521"))
+			point := private.string()
+			d := private.mpint()
+
+			x, y := elliptic.P521().ScalarBaseMult(d.Bytes())
+			Expect(point).To(Equal(elliptic.Marshal(elliptic.P521(), x, y)))
+		})
+
+		It("should generate an Ed25519 keypair", func() {
+			data := generate(secretv1alpha1.PasswordSpec{
+				Generator: secretv1alpha1.GeneratorEd25519,
+				KeyPair:   &secretv1alpha1.KeyPairSpec{Format: secretv1alpha1.KeyFormatOpenSSH},
+			})
+			keyType, publicBlob := parseAuthorizedKey(data[PublicKeyKey])
+			Expect(keyType).To(Equal("ssh-ed25519"))
+			embeddedBlob, private := parseOpenSSH(data[PrivateKeyKey])
+			Expect(embeddedBlob).To(Equal(publicBlob))
+
+			Expect(string(private.string())).To(Equal(keyType))
+			publicKey := private.string()
+			key := ed25519.PrivateKey(private.string())
+			Expect(key).To(HaveLen(ed25519.PrivateKeySize))
+			Expect([]byte(key.Public().(ed25519.PublicKey))).To(Equal(publicKey))
+			Expect(ed25519.NewKeyFromSeed(key.Seed())).To(Equal(key))
+		})
+	})
+
+	It("should reject an unknown curve", func() {
+		_, err := New(secretv1alpha1.PasswordSpec{
+			Generator: secretv1alpha1.GeneratorECDSA,
+			KeyPair:   &secretv1alpha1.KeyPairSpec{Curve: "P192"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
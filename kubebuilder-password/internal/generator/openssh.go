@@ -0,0 +1,165 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+)
+
+// The OpenSSH encoding is small enough to implement here instead of adding a
+// dependency on golang.org/x/crypto/ssh.
+// See PROTOCOL.key in the OpenSSH sources for the format.
+
+const (
+	opensshMagic     = "openssh-key-v1\x00"
+	opensshBlockSize = 8
+)
+
+// marshalOpenSSH encodes the private key as an unencrypted OpenSSH private key
+// and the public key in authorized_keys format.
+func marshalOpenSSH(key crypto.Signer) ([]byte, []byte, error) {
+	keyType, publicBlob, privateFields, err := opensshKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checkInt := make([]byte, 4)
+	if _, err := rand.Read(checkInt); err != nil {
+		return nil, nil, err
+	}
+
+	var private sshBuffer
+	private.raw(checkInt)
+	private.raw(checkInt)
+	private.raw(privateFields)
+	private.string(nil) // comment
+	for i := 1; len(private)%opensshBlockSize != 0; i++ {
+		private = append(private, byte(i))
+	}
+
+	var out sshBuffer
+	out.raw([]byte(opensshMagic))
+	out.string([]byte("none")) // cipher
+	out.string([]byte("none")) // kdf
+	out.string(nil)            // kdf options
+	out.uint32(1)              // number of keys
+	out.string(publicBlob)
+	out.string(private)
+
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: out})
+	publicKey := []byte(keyType + " " + base64.StdEncoding.EncodeToString(publicBlob) + "\n")
+	return privateKey, publicKey, nil
+}
+
+// opensshKey returns the key type name, the public key blob and the
+// type-specific private key fields of key.
+func opensshKey(key crypto.Signer) (string, []byte, []byte, error) {
+	var public, private sshBuffer
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		keyType := "ssh-rsa"
+		public.string([]byte(keyType))
+		public.mpint(big.NewInt(int64(k.E)))
+		public.mpint(k.N)
+
+		iqmp := new(big.Int).ModInverse(k.Primes[1], k.Primes[0])
+		private.string([]byte(keyType))
+		private.mpint(k.N)
+		private.mpint(big.NewInt(int64(k.E)))
+		private.mpint(k.D)
+		private.mpint(iqmp)
+		private.mpint(k.Primes[0])
+		private.mpint(k.Primes[1])
+		return keyType, public, private, nil
+	case *ecdsa.PrivateKey:
+		curveName, err := opensshCurveName(k.Curve)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		keyType := "ecdsa-sha2-" + curveName
+		point := elliptic.Marshal(k.Curve, k.X, k.Y)
+		public.string([]byte(keyType))
+		public.string([]byte(curveName))
+		public.string(point)
+
+		private.string([]byte(keyType))
+		private.string([]byte(curveName))
+		private.string(point)
+		private.mpint(k.D)
+		return keyType, public, private, nil
+	case ed25519.PrivateKey:
+		keyType := "ssh-ed25519"
+		publicKey := k.Public().(ed25519.PublicKey)
+		public.string([]byte(keyType))
+		public.string(publicKey)
+
+		private.string([]byte(keyType))
+		private.string(publicKey)
+		private.string(k)
+		return keyType, public, private, nil
+	default:
+		return "", nil, nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func opensshCurveName(curve elliptic.Curve) (string, error) {
+	switch curve {
+	case elliptic.P256():
+		return "nistp256", nil
+	case elliptic.P384():
+		return "nistp384", nil
+	case elliptic.P521():
+		return "nistp521", nil
+	default:
+		return "", fmt.Errorf("unsupported curve %s", curve.Params().Name)
+	}
+}
+
+// sshBuffer appends values in the SSH wire encoding (RFC 4251 section 5).
+type sshBuffer []byte
+
+func (b *sshBuffer) raw(v []byte) {
+	*b = append(*b, v...)
+}
+
+func (b *sshBuffer) uint32(v uint32) {
+	*b = binary.BigEndian.AppendUint32(*b, v)
+}
+
+func (b *sshBuffer) string(v []byte) {
+	b.uint32(uint32(len(v)))
+	b.raw(v)
+}
+
+func (b *sshBuffer) mpint(v *big.Int) {
+	bytes := v.Bytes()
+	// A positive number whose most significant bit is set needs a leading zero byte.
+	if len(bytes) > 0 && bytes[0]&0x80 != 0 {
+		bytes = append([]byte{0}, bytes...)
+	}
+	b.string(bytes)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"math/big"
+	"strings"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+const (
+	defaultPassphraseWords     = 6
+	defaultPassphraseSeparator = "-"
+)
+
+//go:embed wordlist.txt
+var wordlistData string
+
+// wordlist is the embedded diceware-style wordlist, one word per line.
+var wordlist = strings.Fields(wordlistData)
+
+// passphraseGenerator generates a passphrase of words drawn uniformly from the wordlist.
+type passphraseGenerator struct {
+	words     int
+	separator string
+}
+
+func newPassphraseGenerator(spec *secretv1alpha1.PassphraseSpec) *passphraseGenerator {
+	g := &passphraseGenerator{
+		words:     defaultPassphraseWords,
+		separator: defaultPassphraseSeparator,
+	}
+	if spec != nil {
+		if spec.Words > 0 {
+			g.words = spec.Words
+		}
+		if spec.Separator != "" {
+			g.separator = spec.Separator
+		}
+	}
+	return g
+}
+
+func (g *passphraseGenerator) Generate() (map[string][]byte, error) {
+	max := big.NewInt(int64(len(wordlist)))
+	words := make([]string, g.words)
+	for i := range words {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return nil, err
+		}
+		words[i] = wordlist[n.Int64()]
+	}
+	return map[string][]byte{PasswordKey: []byte(strings.Join(words, g.separator))}, nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+
+	passwordGenerator "github.com/sethvargo/go-password/password"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+var (
+	// ErrMinLettersExceedLetters is returned when minLower + minUpper is larger than the number of letters.
+	ErrMinLettersExceedLetters = errors.New("minimum number of lower and upper case letters exceeds number of letters")
+	// ErrNoCharactersAvailable is returned when excludeCharacters leaves nothing to draw from.
+	ErrNoCharactersAvailable = errors.New("no characters left to draw from after excluding characters")
+)
+
+// randomGenerator generates a random password with sethvargo/go-password.
+type randomGenerator struct {
+	length      int
+	digit       int
+	symbol      int
+	minLower    int
+	minUpper    int
+	noUpper     bool
+	allowRepeat bool
+	sets        secretv1alpha1.PasswordCharacterSets
+}
+
+func newRandomGenerator(spec secretv1alpha1.PasswordSpec) *randomGenerator {
+	return &randomGenerator{
+		length:      spec.Length,
+		digit:       spec.Digit,
+		symbol:      spec.Symbol,
+		minLower:    spec.MinLower,
+		minUpper:    spec.MinUpper,
+		noUpper:     spec.CaseSensitive,
+		allowRepeat: !spec.DisallowRepeat,
+		sets:        spec.CharacterSets(),
+	}
+}
+
+// Generate draws the minimum number of lower and upper case letters first,
+// lets go-password generate the rest and shuffles the result.
+func (g *randomGenerator) Generate() (map[string][]byte, error) {
+	letters := g.length - g.digit - g.symbol
+	if letters < 0 {
+		return nil, passwordGenerator.ErrExceedsTotalLength
+	}
+	if g.minLower+g.minUpper > letters {
+		return nil, ErrMinLettersExceedLetters
+	}
+
+	upper := g.sets.Upper
+	if g.noUpper {
+		upper = ""
+	}
+	lowerPart, err := g.draw(g.sets.Lower, g.minLower, 0, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	upperPart, err := g.draw(upper, g.minUpper, 0, 0, lowerPart)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := g.draw(g.sets.Lower+upper, letters-g.minLower-g.minUpper, g.digit, g.symbol, lowerPart+upperPart)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordStr, err := shuffle(lowerPart + upperPart + rest)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{PasswordKey: []byte(passwordStr)}, nil
+}
+
+// draw generates letters letters, digit digits and symbol symbols with go-password.
+// Letters already used are excluded when repeats are not allowed.
+func (g *randomGenerator) draw(letterSet string, letters, digit, symbol int, used string) (string, error) {
+	if letters+digit+symbol == 0 {
+		return "", nil
+	}
+	if !g.allowRepeat {
+		letterSet = removeUsed(letterSet, used)
+	}
+	// go-passwordは空の文字セットをデフォルトの文字セットで置き換えるため、使用する文字セットが空でないことを確認する
+	if (letters > 0 && letterSet == "") ||
+		(digit > 0 && g.sets.Digits == "") ||
+		(symbol > 0 && g.sets.Symbols == "") {
+		return "", ErrNoCharactersAvailable
+	}
+
+	// 大文字・小文字はLowerLettersにまとめて渡し、noUpperで大文字のデフォルトが混ざらないようにする
+	gen, err := passwordGenerator.NewGenerator(&passwordGenerator.GeneratorInput{
+		LowerLetters: letterSet,
+		Digits:       g.sets.Digits,
+		Symbols:      g.sets.Symbols,
+	})
+	if err != nil {
+		return "", err
+	}
+	return gen.Generate(letters+digit+symbol, digit, symbol, true, g.allowRepeat)
+}
+
+func removeUsed(chars, used string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(used, r) {
+			return -1
+		}
+		return r
+	}, chars)
+}
+
+// shuffle permutes s with a Fisher-Yates shuffle.
+func shuffle(s string) (string, error) {
+	b := []byte(s)
+	for i := len(b) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b), nil
+}
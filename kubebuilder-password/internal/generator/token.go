@@ -0,0 +1,63 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+const defaultTokenBytes = 32
+
+// tokenEncoding encodes the random bytes of a token as text.
+type tokenEncoding struct {
+	encode func([]byte) string
+	decode func(string) ([]byte, error)
+}
+
+var (
+	hexEncoding    = tokenEncoding{encode: hex.EncodeToString, decode: hex.DecodeString}
+	base64Encoding = tokenEncoding{encode: base64.StdEncoding.EncodeToString, decode: base64.StdEncoding.DecodeString}
+)
+
+// tokenGenerator generates N random bytes and encodes them as text.
+type tokenGenerator struct {
+	bytes    int
+	encoding tokenEncoding
+}
+
+func newTokenGenerator(spec *secretv1alpha1.TokenSpec, encoding tokenEncoding) *tokenGenerator {
+	g := &tokenGenerator{
+		bytes:    defaultTokenBytes,
+		encoding: encoding,
+	}
+	if spec != nil && spec.Bytes > 0 {
+		g.bytes = spec.Bytes
+	}
+	return g
+}
+
+func (g *tokenGenerator) Generate() (map[string][]byte, error) {
+	buf := make([]byte, g.bytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return map[string][]byte{PasswordKey: []byte(g.encoding.encode(buf))}, nil
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+// ErrPolicyNotSatisfied is returned by Validate when a value could not have been generated with the spec.
+var ErrPolicyNotSatisfied = errors.New("value does not satisfy the spec")
+
+func policyError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrPolicyNotSatisfied, fmt.Sprintf(format, args...))
+}
+
+func valueOf(data map[string][]byte, key string) (string, error) {
+	value, ok := data[key]
+	if !ok || len(value) == 0 {
+		return "", policyError("missing key %q", key)
+	}
+	return string(value), nil
+}
+
+// Validate checks the length, the character sets and the minimum counts of the password.
+// Longer passwords and more digits or symbols than required are accepted.
+// The errors never contain characters of the password.
+func (g *randomGenerator) Validate(data map[string][]byte) error {
+	value, err := valueOf(data, PasswordKey)
+	if err != nil {
+		return err
+	}
+	if len(value) < g.length {
+		return policyError("shorter than %d characters", g.length)
+	}
+
+	upper := g.sets.Upper
+	if g.noUpper {
+		upper = ""
+	}
+	var lowerCount, upperCount, digitCount, symbolCount int
+	seen := map[rune]bool{}
+	for _, c := range value {
+		switch {
+		case strings.ContainsRune(g.sets.Lower, c):
+			lowerCount++
+		case strings.ContainsRune(upper, c):
+			upperCount++
+		case strings.ContainsRune(g.sets.Digits, c):
+			digitCount++
+		case strings.ContainsRune(g.sets.Symbols, c):
+			symbolCount++
+		default:
+			return policyError("contains a character that is not allowed")
+		}
+		if !g.allowRepeat && seen[c] {
+			return policyError("contains a repeated character")
+		}
+		seen[c] = true
+	}
+
+	switch {
+	case digitCount < g.digit:
+		return policyError("fewer than %d digits", g.digit)
+	case symbolCount < g.symbol:
+		return policyError("fewer than %d symbols", g.symbol)
+	case lowerCount < g.minLower:
+		return policyError("fewer than %d lower case letters", g.minLower)
+	case upperCount < g.minUpper:
+		return policyError("fewer than %d upper case letters", g.minUpper)
+	}
+	return nil
+}
+
+// Validate checks the number of words of the passphrase. Words outside the wordlist are accepted.
+func (g *passphraseGenerator) Validate(data map[string][]byte) error {
+	value, err := valueOf(data, PasswordKey)
+	if err != nil {
+		return err
+	}
+	words := strings.Split(value, g.separator)
+	if len(words) < g.words {
+		return policyError("fewer than %d words", g.words)
+	}
+	for _, word := range words {
+		if word == "" {
+			return policyError("empty word")
+		}
+	}
+	return nil
+}
+
+// Validate checks the encoding and the number of random bytes of the token.
+func (g *tokenGenerator) Validate(data map[string][]byte) error {
+	value, err := valueOf(data, PasswordKey)
+	if err != nil {
+		return err
+	}
+	decoded, err := g.encoding.decode(value)
+	if err != nil {
+		return policyError("invalid encoding")
+	}
+	if len(decoded) < g.bytes {
+		return policyError("fewer than %d bytes", g.bytes)
+	}
+	return nil
+}
+
+func (g *uuidGenerator) Validate(data map[string][]byte) error {
+	value, err := valueOf(data, PasswordKey)
+	if err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(value); err != nil {
+		return policyError("invalid UUID")
+	}
+	return nil
+}
+
+// Validate checks the type, size and format of the keypair.
+func (g *keyPairGenerator) Validate(data map[string][]byte) error {
+	privateKey, err := valueOf(data, PrivateKeyKey)
+	if err != nil {
+		return err
+	}
+	publicKey, err := valueOf(data, PublicKeyKey)
+	if err != nil {
+		return err
+	}
+
+	if g.format == secretv1alpha1.KeyFormatOpenSSH {
+		block, _ := pem.Decode([]byte(privateKey))
+		if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+			return policyError("private key is not an OpenSSH private key")
+		}
+		keyType, err := g.opensshKeyType()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(publicKey, keyType+" ") {
+			return policyError("public key is not a %s key", keyType)
+		}
+		return nil
+	}
+
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return policyError("private key is not a PEM encoded PKCS#8 key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return policyError("invalid private key")
+	}
+	if block, _ := pem.Decode([]byte(publicKey)); block == nil || block.Type != "PUBLIC KEY" {
+		return policyError("public key is not a PEM encoded PKIX key")
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if g.keyType != secretv1alpha1.GeneratorRSA {
+			return policyError("private key is an RSA key")
+		}
+		if k.N.BitLen() < g.bits {
+			return policyError("RSA key is shorter than %d bits", g.bits)
+		}
+	case *ecdsa.PrivateKey:
+		if g.keyType != secretv1alpha1.GeneratorECDSA {
+			return policyError("private key is an ECDSA key")
+		}
+		if k.Curve != g.curve {
+			return policyError("ECDSA key uses curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PrivateKey:
+		if g.keyType != secretv1alpha1.GeneratorEd25519 {
+			return policyError("private key is an Ed25519 key")
+		}
+	default:
+		return policyError("unsupported private key %T", key)
+	}
+	return nil
+}
+
+// opensshKeyType returns the OpenSSH name of the key type of g.
+func (g *keyPairGenerator) opensshKeyType() (string, error) {
+	switch g.keyType {
+	case secretv1alpha1.GeneratorRSA:
+		return "ssh-rsa", nil
+	case secretv1alpha1.GeneratorECDSA:
+		curveName, err := opensshCurveName(g.curve)
+		if err != nil {
+			return "", err
+		}
+		return "ecdsa-sha2-" + curveName, nil
+	case secretv1alpha1.GeneratorEd25519:
+		return "ssh-ed25519", nil
+	default:
+		return "", fmt.Errorf("unknown key type %q", g.keyType)
+	}
+}
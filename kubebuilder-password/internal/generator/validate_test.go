@@ -0,0 +1,101 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+func validate(spec secretv1alpha1.PasswordSpec, value string) error {
+	g, err := New(spec)
+	Expect(err).NotTo(HaveOccurred())
+	return g.Validate(map[string][]byte{PasswordKey: []byte(value)})
+}
+
+var _ = Describe("Validate", func() {
+	It("should accept generated values", func() {
+		for _, spec := range []secretv1alpha1.PasswordSpec{
+			{Length: 20, Digit: 5, Symbol: 5, MinLower: 2, MinUpper: 2, DisallowRepeat: true},
+			{Generator: secretv1alpha1.GeneratorPassphrase},
+			{Generator: secretv1alpha1.GeneratorHex},
+			{Generator: secretv1alpha1.GeneratorBase64},
+			{Generator: secretv1alpha1.GeneratorUUID},
+			{Generator: secretv1alpha1.GeneratorECDSA},
+			{Generator: secretv1alpha1.GeneratorEd25519, KeyPair: &secretv1alpha1.KeyPairSpec{Format: secretv1alpha1.KeyFormatOpenSSH}},
+		} {
+			g, err := New(spec)
+			Expect(err).NotTo(HaveOccurred())
+			data, err := g.Generate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(g.Validate(data)).To(Succeed(), "generator %q", spec.Generator)
+		}
+	})
+
+	Context("Password", func() {
+		spec := secretv1alpha1.PasswordSpec{Length: 10, Digit: 2, Symbol: 1, ExcludeCharacters: "0O"}
+
+		It("should accept a longer value with more digits", func() {
+			Expect(validate(spec, "abcdefgh123456!")).To(Succeed())
+		})
+
+		It("should reject a short value", func() {
+			Expect(validate(spec, "abc12!")).To(MatchError(ErrPolicyNotSatisfied))
+		})
+
+		It("should reject too few digits", func() {
+			Expect(validate(spec, "abcdefghi1!")).To(MatchError(ErrPolicyNotSatisfied))
+		})
+
+		It("should reject excluded characters", func() {
+			Expect(validate(spec, "abcdefgh12!O")).To(MatchError(ErrPolicyNotSatisfied))
+		})
+
+		It("should reject repeated characters when disallowRepeat is set", func() {
+			noRepeat := spec
+			noRepeat.DisallowRepeat = true
+			Expect(validate(noRepeat, "abcdefgh12!a")).To(MatchError(ErrPolicyNotSatisfied))
+		})
+
+		It("should reject a missing key", func() {
+			g, err := New(spec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(g.Validate(map[string][]byte{"other": []byte("x")})).To(MatchError(ErrPolicyNotSatisfied))
+		})
+	})
+
+	It("should reject a passphrase with too few words", func() {
+		Expect(validate(secretv1alpha1.PasswordSpec{Generator: secretv1alpha1.GeneratorPassphrase}, "one-two-three")).To(MatchError(ErrPolicyNotSatisfied))
+	})
+
+	It("should reject a token that is not hex", func() {
+		Expect(validate(secretv1alpha1.PasswordSpec{Generator: secretv1alpha1.GeneratorHex}, "not hex")).To(MatchError(ErrPolicyNotSatisfied))
+	})
+
+	It("should reject a keypair of another type", func() {
+		g, err := New(secretv1alpha1.PasswordSpec{Generator: secretv1alpha1.GeneratorEd25519})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := g.Generate()
+		Expect(err).NotTo(HaveOccurred())
+
+		other, err := New(secretv1alpha1.PasswordSpec{Generator: secretv1alpha1.GeneratorECDSA})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(other.Validate(data)).To(MatchError(ErrPolicyNotSatisfied))
+	})
+})
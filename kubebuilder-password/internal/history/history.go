@@ -0,0 +1,95 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package history keeps salted hashes of previously generated Secret values
+// so that a regenerated value never repeats a recent one.
+package history
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+)
+
+const saltSize = 32
+
+// Record is the salted hash of one generated value.
+// The values are generated with high entropy, so a single HMAC-SHA256 round
+// is enough to make the hashes useless for recovering them.
+type Record struct {
+	Salt        []byte    `json:"salt"`
+	Hash        []byte    `json:"hash"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+// History is the list of records, newest first.
+type History []Record
+
+// Parse decodes a History stored by Marshal. Empty data is an empty History.
+func Parse(data []byte) (History, error) {
+	var h History
+	if len(data) == 0 {
+		return h, nil
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Marshal encodes the History.
+func (h History) Marshal() ([]byte, error) {
+	return json.Marshal(h)
+}
+
+// Contains reports whether value matches any record.
+func (h History) Contains(value []byte) bool {
+	for _, e := range h {
+		if hmac.Equal(hash(e.Salt, value), e.Hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add records value as the newest record and keeps at most size records.
+func (h History) Add(value []byte, now time.Time, size int) (History, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	record := Record{Salt: salt, Hash: hash(salt, value), GeneratedAt: now.UTC()}
+	return append(History{record}, h...).Trim(size), nil
+}
+
+// Trim keeps at most size of the newest records.
+func (h History) Trim(size int) History {
+	if size < 0 {
+		size = 0
+	}
+	if len(h) > size {
+		return h[:size]
+	}
+	return h
+}
+
+func hash(salt, value []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(value)
+	return mac.Sum(nil)
+}
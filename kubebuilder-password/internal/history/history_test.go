@@ -0,0 +1,81 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("History", func() {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	It("should find added values and nothing else", func() {
+		h, err := History{}.Add([]byte("first"), now, 3)
+		Expect(err).NotTo(HaveOccurred())
+		h, err = h.Add([]byte("second"), now, 3)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(h.Contains([]byte("first"))).To(BeTrue())
+		Expect(h.Contains([]byte("second"))).To(BeTrue())
+		Expect(h.Contains([]byte("third"))).To(BeFalse())
+	})
+
+	It("should salt every record", func() {
+		h, err := History{}.Add([]byte("same"), now, 2)
+		Expect(err).NotTo(HaveOccurred())
+		h, err = h.Add([]byte("same"), now, 2)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(h[0].Salt).NotTo(Equal(h[1].Salt))
+		Expect(h[0].Hash).NotTo(Equal(h[1].Hash))
+	})
+
+	It("should keep only the newest records", func() {
+		var h History
+		var err error
+		for _, v := range []string{"a", "b", "c", "d"} {
+			h, err = h.Add([]byte(v), now, 2)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(h).To(HaveLen(2))
+		Expect(h.Contains([]byte("d"))).To(BeTrue())
+		Expect(h.Contains([]byte("c"))).To(BeTrue())
+		Expect(h.Contains([]byte("b"))).To(BeFalse())
+	})
+
+	It("should round-trip through Marshal and Parse without storing the value", func() {
+		h, err := History{}.Add([]byte("secret-value"), now, 5)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := h.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("secret-value"))
+
+		parsed, err := Parse(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(h))
+		Expect(parsed.Contains([]byte("secret-value"))).To(BeTrue())
+	})
+
+	It("should parse empty data as an empty history", func() {
+		h, err := Parse(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h).To(BeEmpty())
+	})
+})
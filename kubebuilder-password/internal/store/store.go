@@ -0,0 +1,71 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package store writes generated values to external secret stores described by a SecretStore.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+// Backend writes secret data to an external secret store.
+// Push doesn't retry: a failed push is retried by the reconciler with the rate limiter of the controller.
+type Backend interface {
+	Push(ctx context.Context, key string, data map[string][]byte) error
+}
+
+// ErrInsecureServer is returned for an http:// Vault server without AllowInsecureHTTP.
+var ErrInsecureServer = errors.New("server must use https unless allowInsecureHTTP is set")
+
+// NewBackend returns the Backend configured by store.
+// Credentials are read from Secrets in the namespace of store.
+func NewBackend(ctx context.Context, c client.Client, store *secretv1alpha1.SecretStore) (Backend, error) {
+	switch {
+	case store.Spec.Vault != nil:
+		// トークンを平文で送らないように、明示的に許可されていない限りhttpsのみ使用する
+		if !strings.HasPrefix(store.Spec.Vault.Server, "https://") && !store.Spec.Vault.AllowInsecureHTTP {
+			return nil, fmt.Errorf("SecretStore %s/%s: %w", store.Namespace, store.Name, ErrInsecureServer)
+		}
+		token, err := secretValue(ctx, c, store.Namespace, store.Spec.Vault.TokenSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		return NewVaultBackend(store.Spec.Vault, token, nil), nil
+	default:
+		return nil, fmt.Errorf("SecretStore %s/%s has no provider", store.Namespace, store.Name)
+	}
+}
+
+func secretValue(ctx context.Context, c client.Client, namespace string, ref secretv1alpha1.SecretKeySelector) (string, error) {
+	var secret corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("Secret %s/%s has no key %q", namespace, ref.Name, ref.Key)
+	}
+	return string(value), nil
+}
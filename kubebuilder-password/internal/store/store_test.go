@@ -0,0 +1,61 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+var _ = Describe("NewBackend", func() {
+	newStore := func(server string, allowInsecureHTTP bool) *secretv1alpha1.SecretStore {
+		return &secretv1alpha1.SecretStore{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault", Namespace: "default"},
+			Spec: secretv1alpha1.SecretStoreSpec{Vault: &secretv1alpha1.VaultProvider{
+				Server:            server,
+				AllowInsecureHTTP: allowInsecureHTTP,
+				TokenSecretRef:    secretv1alpha1.SecretKeySelector{Name: "vault-token", Key: "token"},
+			}},
+		}
+	}
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "vault-token", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("root")},
+	}).Build()
+
+	It("should accept an https server", func() {
+		backend, err := NewBackend(context.Background(), c, newStore("https://vault.example.com:8200", false))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backend).NotTo(BeNil())
+	})
+
+	// トークンを平文で送らないように、httpは明示的に許可した場合のみ使用できる
+	It("should reject an http server unless allowInsecureHTTP is set", func() {
+		_, err := NewBackend(context.Background(), c, newStore("http://vault.example.com:8200", false))
+		Expect(err).To(MatchError(ErrInsecureServer))
+
+		_, err = NewBackend(context.Background(), c, newStore("http://vault.example.com:8200", true))
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,100 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+const defaultVaultMount = "secret"
+
+// VaultBackend writes to a Vault-compatible KV version 2 secrets engine over HTTP.
+type VaultBackend struct {
+	server    string
+	mount     string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+// NewVaultBackend returns a VaultBackend authenticating with token.
+// A nil httpClient uses a client with a 30 second timeout.
+func NewVaultBackend(provider *secretv1alpha1.VaultProvider, token string, httpClient *http.Client) *VaultBackend {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	mount := strings.Trim(provider.Path, "/")
+	if mount == "" {
+		mount = defaultVaultMount
+	}
+	return &VaultBackend{
+		server:    strings.TrimRight(provider.Server, "/"),
+		mount:     mount,
+		namespace: provider.Namespace,
+		token:     token,
+		client:    httpClient,
+	}
+}
+
+// Push writes data as a new version of the secret at key.
+func (b *VaultBackend) Push(ctx context.Context, key string, data map[string][]byte) error {
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		values[k] = string(v)
+	}
+	body, err := json.Marshal(map[string]interface{}{"data": values})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/data/%s", b.server, b.mount, strings.Trim(key, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", b.token)
+	if b.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", b.namespace)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	// エラーレスポンスのbodyは{"errors": [...]}の形式
+	var vaultErr struct {
+		Errors []string `json:"errors"`
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	_ = json.Unmarshal(respBody, &vaultErr)
+	return fmt.Errorf("vault returned %s for %s: %s", resp.Status, key, strings.Join(vaultErr.Errors, ", "))
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	secretv1alpha1 "example.com/password-operator/api/v1alpha1"
+)
+
+// fakeVault is a minimal KV version 2 server keeping the latest version of every secret.
+type fakeVault struct {
+	mu       sync.Mutex
+	token    string
+	failures int // number of requests answered with 503 before succeeding
+	requests int
+	secrets  map[string]map[string]string
+	headers  http.Header
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	f.headers = r.Header.Clone()
+
+	if r.Header.Get("X-Vault-Token") != f.token {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"errors":["Vault is sealed"]}`))
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.secrets[r.URL.Path] = body.Data
+	_, _ = w.Write([]byte(`{"data":{"version":1}}`))
+}
+
+var _ = Describe("VaultBackend", func() {
+	var (
+		vault   *fakeVault
+		server  *httptest.Server
+		backend *VaultBackend
+		data    = map[string][]byte{"password": []byte("s3cr3t")}
+	)
+
+	BeforeEach(func() {
+		vault = &fakeVault{token: "root", secrets: map[string]map[string]string{}}
+		server = httptest.NewServer(vault)
+		backend = NewVaultBackend(&secretv1alpha1.VaultProvider{
+			Server:    server.URL + "/",
+			Path:      "kv",
+			Namespace: "team-a",
+		}, "root", server.Client())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should write the data to the KV version 2 data path", func() {
+		Expect(backend.Push(context.Background(), "apps/database", data)).To(Succeed())
+		Expect(vault.secrets).To(HaveKeyWithValue("/v1/kv/data/apps/database", map[string]string{"password": "s3cr3t"}))
+		Expect(vault.headers.Get("X-Vault-Namespace")).To(Equal("team-a"))
+	})
+
+	It("should default the mount path to secret", func() {
+		backend = NewVaultBackend(&secretv1alpha1.VaultProvider{Server: server.URL}, "root", server.Client())
+		Expect(backend.Push(context.Background(), "db", data)).To(Succeed())
+		Expect(vault.secrets).To(HaveKey("/v1/secret/data/db"))
+	})
+
+	It("should report a rejected token", func() {
+		backend = NewVaultBackend(&secretv1alpha1.VaultProvider{Server: server.URL}, "wrong", server.Client())
+		err := backend.Push(context.Background(), "db", data)
+		Expect(err).To(MatchError(ContainSubstring("permission denied")))
+		Expect(vault.requests).To(Equal(1))
+	})
+
+	// リトライはコントローラーのrate limiterに任せ、Pushは一度だけ書き込む
+	It("should not retry server errors", func() {
+		vault.failures = 2
+		err := backend.Push(context.Background(), "db", data)
+		Expect(err).To(MatchError(ContainSubstring("Vault is sealed")))
+		Expect(vault.requests).To(Equal(1))
+
+		Expect(backend.Push(context.Background(), "db", data)).To(HaveOccurred())
+		Expect(backend.Push(context.Background(), "db", data)).To(Succeed())
+		Expect(vault.secrets).To(HaveKey("/v1/kv/data/db"))
+	})
+
+	It("should report an unreachable server", func() {
+		server.Close()
+		Expect(backend.Push(context.Background(), "db", data)).To(HaveOccurred())
+	})
+})
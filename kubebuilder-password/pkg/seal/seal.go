@@ -0,0 +1,293 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package seal encrypts Secret values with a public key so that they can be
+// exported, e.g. committed to git, and only be decrypted by the owner of the private key.
+// It is used by the operator to seal values and by the unseal command (cmd/unseal) to open them.
+//
+// Every value is sealed in an Envelope, serialized as JSON with the binary fields in standard base64:
+//
+//	{"version":1,"algorithm":"...","ephemeralKey":"...","encryptedKey":"...","nonce":"...","ciphertext":"..."}
+//
+// The value is encrypted with AES-256-GCM under a random 32 byte data key and a 12 byte nonce;
+// the ciphertext includes the 16 byte tag. The associated data is the key of the value in the Secret.
+// For AlgorithmRSAOAEP the data key is encrypted with RSA-OAEP (SHA-256, no label) into encryptedKey.
+// For AlgorithmX25519 the data key is derived with HKDF-SHA256 (RFC 5869) from the X25519 shared
+// secret of the private key and ephemeralKey, with the salt ephemeralKey || recipient public key
+// and the info "password-operator/seal/v1".
+//
+// The format is not compatible with age. X25519 keys require Go 1.20 (crypto/ecdh).
+package seal
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Algorithms of an Envelope.
+const (
+	AlgorithmX25519  = "X25519-HKDF-SHA256-AES256GCM"
+	AlgorithmRSAOAEP = "RSA-OAEP-SHA256-AES256GCM"
+)
+
+const (
+	envelopeVersion = 1
+	dataKeySize     = 32
+	// hkdfInfo binds derived keys to this format.
+	hkdfInfo = "password-operator/seal/v1"
+)
+
+var (
+	// ErrUnsupportedKey is returned for keys other than RSA and X25519.
+	ErrUnsupportedKey = errors.New("unsupported key: must be an RSA or X25519 key")
+	// ErrInvalidEnvelope is returned when an Envelope can't be decrypted.
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+)
+
+// Envelope is a sealed value. It is serialized as JSON.
+type Envelope struct {
+	Version   int    `json:"version"`
+	Algorithm string `json:"algorithm"`
+	// EphemeralKey is the ephemeral X25519 public key of the sender (X25519 only).
+	EphemeralKey []byte `json:"ephemeralKey,omitempty"`
+	// EncryptedKey is the data key encrypted with RSA-OAEP (RSA-OAEP only).
+	EncryptedKey []byte `json:"encryptedKey,omitempty"`
+	Nonce        []byte `json:"nonce"`
+	Ciphertext   []byte `json:"ciphertext"`
+}
+
+// Recipient seals values for the owner of a private key.
+type Recipient interface {
+	// Seal encrypts plaintext. associatedData is authenticated but not encrypted
+	// and must be passed to Open unchanged.
+	Seal(plaintext, associatedData []byte) (*Envelope, error)
+	// Fingerprint identifies the public key of the Recipient.
+	Fingerprint() string
+}
+
+// ParseRecipient parses a PEM encoded PKIX public key ("PUBLIC KEY"), as written by
+// `openssl pkey -pubout`, of type RSA or X25519.
+func ParseRecipient(data []byte) (Recipient, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("public key must be a PEM encoded PKIX public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := sha256.Sum256(block.Bytes)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &rsaRecipient{key: k, fingerprint: hex.EncodeToString(fingerprint[:])}, nil
+	case *ecdh.PublicKey:
+		if k.Curve() != ecdh.X25519() {
+			return nil, ErrUnsupportedKey
+		}
+		return &x25519Recipient{key: k, fingerprint: hex.EncodeToString(fingerprint[:])}, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS #8 private key ("PRIVATE KEY"), as written by
+// `openssl genpkey`, or a PKCS #1 RSA private key ("RSA PRIVATE KEY"), for Open.
+func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key must be PEM encoded")
+	}
+	var (
+		key crypto.PrivateKey
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdh.PrivateKey:
+		if k.Curve() != ecdh.X25519() {
+			return nil, ErrUnsupportedKey
+		}
+		return k, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+type rsaRecipient struct {
+	key         *rsa.PublicKey
+	fingerprint string
+}
+
+func (r *rsaRecipient) Fingerprint() string { return r.fingerprint }
+
+func (r *rsaRecipient) Seal(plaintext, associatedData []byte) (*Envelope, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.key, dataKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	e := &Envelope{Version: envelopeVersion, Algorithm: AlgorithmRSAOAEP, EncryptedKey: encryptedKey}
+	return e, e.encrypt(dataKey, plaintext, associatedData)
+}
+
+type x25519Recipient struct {
+	key         *ecdh.PublicKey
+	fingerprint string
+}
+
+func (r *x25519Recipient) Fingerprint() string { return r.fingerprint }
+
+func (r *x25519Recipient) Seal(plaintext, associatedData []byte) (*Envelope, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(r.key)
+	if err != nil {
+		return nil, err
+	}
+	e := &Envelope{Version: envelopeVersion, Algorithm: AlgorithmX25519, EphemeralKey: ephemeral.PublicKey().Bytes()}
+	dataKey, err := deriveKey(shared, e.EphemeralKey, r.key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return e, e.encrypt(dataKey, plaintext, associatedData)
+}
+
+// Open decrypts e with privateKey, which is an *rsa.PrivateKey or an X25519 *ecdh.PrivateKey.
+func Open(e *Envelope, privateKey crypto.PrivateKey, associatedData []byte) ([]byte, error) {
+	if e.Version != envelopeVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidEnvelope, e.Version)
+	}
+
+	var dataKey []byte
+	switch e.Algorithm {
+	case AlgorithmRSAOAEP:
+		key, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s requires an RSA private key", ErrInvalidEnvelope, e.Algorithm)
+		}
+		var err error
+		dataKey, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, key, e.EncryptedKey, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+		}
+	case AlgorithmX25519:
+		key, ok := privateKey.(*ecdh.PrivateKey)
+		if !ok || key.Curve() != ecdh.X25519() {
+			return nil, fmt.Errorf("%w: %s requires an X25519 private key", ErrInvalidEnvelope, e.Algorithm)
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(e.EphemeralKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+		}
+		shared, err := key.ECDH(ephemeral)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+		}
+		dataKey, err = deriveKey(shared, e.EphemeralKey, key.PublicKey().Bytes())
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown algorithm %q", ErrInvalidEnvelope, e.Algorithm)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+	return plaintext, nil
+}
+
+// Marshal returns the JSON encoding of e.
+func (e *Envelope) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Unmarshal parses the JSON encoding of an Envelope.
+func Unmarshal(data []byte) (*Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+	return &e, nil
+}
+
+func (e *Envelope) encrypt(dataKey, plaintext, associatedData []byte) error {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, e.Nonce); err != nil {
+		return err
+	}
+	e.Ciphertext = aead.Seal(nil, e.Nonce, plaintext, associatedData)
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey derives the data key from an X25519 shared secret with HKDF-SHA256 (RFC 5869),
+// salted with both public keys.
+func deriveKey(shared, ephemeralKey, recipientKey []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeralKey...), recipientKey...)
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(hkdfInfo)), dataKey); err != nil {
+		return nil, err
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seal
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func publicKeyPEM(key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+var _ = Describe("Seal", func() {
+	var (
+		rsaKey    *rsa.PrivateKey
+		x25519Key *ecdh.PrivateKey
+	)
+
+	BeforeEach(func() {
+		var err error
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		x25519Key, err = ecdh.X25519().GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// 暗号化した値が秘密鍵で復号できることをテスト
+	DescribeTable("round trip",
+		func(publicKey func() crypto.PublicKey, privateKey func() crypto.PrivateKey, algorithm string) {
+			recipient, err := ParseRecipient(publicKeyPEM(publicKey()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recipient.Fingerprint()).To(HaveLen(64))
+
+			envelope, err := recipient.Seal([]byte("s3cr3t-value"), []byte("password"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(envelope.Algorithm).To(Equal(algorithm))
+			Expect(string(envelope.Ciphertext)).NotTo(ContainSubstring("s3cr3t-value"))
+
+			data, err := envelope.Marshal()
+			Expect(err).NotTo(HaveOccurred())
+			decoded, err := Unmarshal(data)
+			Expect(err).NotTo(HaveOccurred())
+
+			plaintext, err := Open(decoded, privateKey(), []byte("password"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(plaintext)).To(Equal("s3cr3t-value"))
+
+			// associated dataが異なる場合は復号できない
+			_, err = Open(decoded, privateKey(), []byte("other"))
+			Expect(err).To(MatchError(ErrInvalidEnvelope))
+		},
+		Entry("RSA-OAEP",
+			func() crypto.PublicKey { return &rsaKey.PublicKey },
+			func() crypto.PrivateKey { return rsaKey },
+			AlgorithmRSAOAEP),
+		Entry("X25519",
+			func() crypto.PublicKey { return x25519Key.PublicKey() },
+			func() crypto.PrivateKey { return x25519Key },
+			AlgorithmX25519),
+	)
+
+	It("should produce a different envelope every time", func() {
+		recipient, err := ParseRecipient(publicKeyPEM(x25519Key.PublicKey()))
+		Expect(err).NotTo(HaveOccurred())
+		a, err := recipient.Seal([]byte("value"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := recipient.Seal([]byte("value"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(a.Ciphertext).NotTo(Equal(b.Ciphertext))
+	})
+
+	It("should not open with another key", func() {
+		recipient, err := ParseRecipient(publicKeyPEM(x25519Key.PublicKey()))
+		Expect(err).NotTo(HaveOccurred())
+		envelope, err := recipient.Seal([]byte("value"), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		other, err := ecdh.X25519().GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = Open(envelope, other, nil)
+		Expect(err).To(MatchError(ErrInvalidEnvelope))
+
+		_, err = Open(envelope, rsaKey, nil)
+		Expect(err).To(MatchError(ErrInvalidEnvelope))
+	})
+
+	It("should reject tampered ciphertext", func() {
+		recipient, err := ParseRecipient(publicKeyPEM(&rsaKey.PublicKey))
+		Expect(err).NotTo(HaveOccurred())
+		envelope, err := recipient.Seal([]byte("value"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		envelope.Ciphertext[0] ^= 0xff
+		_, err = Open(envelope, rsaKey, nil)
+		Expect(err).To(MatchError(ErrInvalidEnvelope))
+	})
+
+	// openssl genpkeyで作成した形式の秘密鍵で復号できることをテスト
+	It("should parse PEM encoded private keys", func() {
+		for _, key := range []crypto.PrivateKey{rsaKey, x25519Key} {
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			parsed, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed).To(Equal(key))
+		}
+
+		parsed, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(rsaKey))
+
+		ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		der, err := x509.MarshalPKCS8PrivateKey(ecdsaKey)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		Expect(err).To(MatchError(ErrUnsupportedKey))
+	})
+
+	It("should reject unsupported keys", func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ParseRecipient(publicKeyPEM(&key.PublicKey))
+		Expect(err).To(MatchError(ErrUnsupportedKey))
+
+		_, err = ParseRecipient([]byte("not a key"))
+		Expect(err).To(HaveOccurred())
+	})
+})
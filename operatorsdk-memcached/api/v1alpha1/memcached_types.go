@@ -17,27 +17,266 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// Condition types of Memcached
+const (
+	// ConditionAvailable reports whether at least one memcached pod is ready to serve clients
+	ConditionAvailable = "Available"
+	// ConditionProgressing reports whether the workload is rolling out a change of the spec
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded reports whether some memcached pods are failing
+	ConditionDegraded = "Degraded"
+)
+
+// WorkloadType is the kind of the workload running the memcached pods
+// +kubebuilder:validation:Enum=Deployment;StatefulSet
+type WorkloadType string
+
+const (
+	// WorkloadTypeDeployment runs the memcached pods with a Deployment
+	WorkloadTypeDeployment WorkloadType = "Deployment"
+	// WorkloadTypeStatefulSet runs the memcached pods with a StatefulSet, giving them stable
+	// names "<name>-<ordinal>" and DNS names in the headless Service
+	WorkloadTypeStatefulSet WorkloadType = "StatefulSet"
+)
+
+// ServiceSpec configures the Services in front of the memcached pods
+type ServiceSpec struct {
+	// ClusterIP creates a ClusterIP Service named after the Memcached in addition to
+	// the headless Service "<name>-headless" that is always created
+	// +optional
+	ClusterIP bool `json:"clusterIP,omitempty"`
+}
+
+// AuthSpec configures the SASL authentication of memcached
+type AuthSpec struct {
+	// SecretName is the name of the Secret in the namespace of the Memcached holding the SASL credentials
+	// in the "memcached-sasl-pwdb" key, one "username:password" per line.
+	// The memcached image must be built with SASL support.
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+}
+
+// TLSSpec configures the TLS of memcached
+type TLSSpec struct {
+	// SecretName is the name of the kubernetes.io/tls Secret in the namespace of the Memcached
+	// holding the certificate chain in "tls.crt" and the private key in "tls.key".
+	// The memcached image must be built with TLS support (memcached 1.5.13 or later).
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+}
+
+// MonitoringSpec configures the Prometheus exporter of the memcached pods
+type MonitoringSpec struct {
+	// Enabled adds a memcached-exporter sidecar to the memcached pods and, if the
+	// ServiceMonitor CRD of the Prometheus Operator is installed, a ServiceMonitor.
+	// It can't be set together with Auth or TLS.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// ExporterImage is the memcached-exporter container image
+	// +kubebuilder:default:="prom/memcached-exporter:v0.13.0"
+	// +optional
+	ExporterImage string `json:"exporterImage,omitempty"`
+
+	// Interval is the scrape interval of the ServiceMonitor, e.g. "30s".
+	// The Prometheus default is used if not set.
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]+)?(ms|s|m|h))+$`
+	// +optional
+	Interval string `json:"interval,omitempty"`
+}
+
+// AutoscalingSpec configures the HorizontalPodAutoscaler of the memcached workload
+type AutoscalingSpec struct {
+	// MinReplicas is the lower limit of the replicas
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the upper limit of the replicas
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetCPUUtilizationPercentage is the target average CPU utilization of the memcached pods
+	// in percent of the requested CPU. It defaults to 80 if no CustomMetric is set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// CustomMetric is a per-pod metric served by the custom metrics API
+	// +optional
+	CustomMetric *CustomMetricTarget `json:"customMetric,omitempty"`
+}
+
+// CustomMetricTarget is the target average value of a per-pod custom metric
+type CustomMetricTarget struct {
+	// Name is the name of the metric
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// AverageValue is the target value of the metric averaged across the memcached pods
+	AverageValue resource.Quantity `json:"averageValue"`
+}
+
+// PodDisruptionBudgetSpec configures the PodDisruptionBudget of the memcached pods
+type PodDisruptionBudgetSpec struct {
+	// MinAvailable is the number or percentage of the memcached pods that must stay available
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number or percentage of the memcached pods that can be unavailable.
+	// It is ignored if MinAvailable is set, and defaults to 1 if neither is set.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
 // MemcachedSpec defines the desired state of Memcached
+// +kubebuilder:validation:XValidation:rule="!has(self.autoscaling) || (has(self.autoscaling.customMetric) && !has(self.autoscaling.targetCPUUtilizationPercentage)) || (has(self.resources) && has(self.resources.requests) && 'cpu' in self.resources.requests)",message="autoscaling on CPU utilization requires resources.requests.cpu"
+// +kubebuilder:validation:XValidation:rule="!has(self.autoscaling) || !has(oldSelf.autoscaling) || self.size == oldSelf.size",message="size can't be changed while autoscaling is set, the replicas are managed by the HorizontalPodAutoscaler"
+// +kubebuilder:validation:XValidation:rule="!has(self.monitoring) || !has(self.monitoring.enabled) || !self.monitoring.enabled || (!has(self.auth) && !has(self.tls))",message="monitoring can't be enabled with auth or tls, the exporter connects to memcached without SASL and TLS"
 type MemcachedSpec struct {
 	// +kubebuilder:validation:Minimum=0
-	// Size is the size of the memcached deployment
+	// Size is the size of the memcached deployment.
+	// It is also written by the scale subresource, which is rejected while Autoscaling is set.
 	Size int32 `json:"size"`
+
+	// Image is the memcached container image
+	// +kubebuilder:default:="memcached:1.4.36-alpine"
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// MemoryLimitMB is the item memory in megabytes (memcached -m)
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=64
+	// +optional
+	MemoryLimitMB int32 `json:"memoryLimitMB,omitempty"`
+
+	// MaxConnections is the max simultaneous connections (memcached -c).
+	// The memcached default is used if not set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+
+	// Threads is the number of threads to use (memcached -t).
+	// The memcached default is used if not set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Threads int32 `json:"threads,omitempty"`
+
+	// ExtraArgs are appended to the memcached command line
+	// +optional
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+
+	// Resources are the compute resources of the memcached container
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Auth enables the SASL authentication of memcached if set (memcached -S)
+	// +optional
+	Auth *AuthSpec `json:"auth,omitempty"`
+
+	// TLS enables TLS on the memcached port if set (memcached -Z)
+	// +optional
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// Affinity is the scheduling constraints of the memcached pods
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// Tolerations are the tolerations of the memcached pods
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// NodeSelector selects the nodes the memcached pods can be scheduled to
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// PriorityClassName is the priority class of the memcached pods
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// SpreadAcrossZones spreads the memcached pods across zones and nodes.
+	// It adds a topology spread constraint over zones and a preferred pod anti-affinity over nodes,
+	// both of which are soft so that the pods can still be scheduled if they cannot be satisfied.
+	// +optional
+	SpreadAcrossZones bool `json:"spreadAcrossZones,omitempty"`
+
+	// Service configures the Services in front of the memcached pods
+	// +optional
+	Service ServiceSpec `json:"service,omitempty"`
+
+	// WorkloadType is the kind of the workload running the memcached pods.
+	// When it is changed, the previous workload is deleted once the new one is ready.
+	// +kubebuilder:default:=Deployment
+	// +optional
+	WorkloadType WorkloadType `json:"workloadType,omitempty"`
+
+	// Monitoring configures the Prometheus exporter of the memcached pods
+	// +optional
+	Monitoring MonitoringSpec `json:"monitoring,omitempty"`
+
+	// Autoscaling creates a HorizontalPodAutoscaler scaling the memcached workload if set.
+	// The replicas of the workload are then managed by the HorizontalPodAutoscaler,
+	// and Size is only used as the initial replicas and can't be changed.
+	// Scaling on CPU utilization, the default without a CustomMetric, requires Resources.Requests.CPU.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// PodDisruptionBudget creates a PodDisruptionBudget for the memcached pods if set
+	// +optional
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
 }
 
 // MemcachedStatus defines the observed state of Memcached
 type MemcachedStatus struct {
-	// Nodes are the names of the memcached pods
+	// Nodes are the names of the ready memcached pods
 	Nodes []string `json:"nodes"`
+
+	// Replicas is the desired number of memcached pods of the workload.
+	// It differs from Size while the workload is scaled by the HorizontalPodAutoscaler.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Selector is the label selector of the memcached pods, used by the scale subresource
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// ReadyReplicas is the number of ready memcached pods
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// ObservedGeneration is the generation of the Memcached last processed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions are the Available, Progressing and Degraded conditions of the Memcached
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Endpoints are the "host:port" addresses of the ready memcached pods, sorted.
+	// The hosts are the DNS names of the pods in StatefulSet mode and the pod IPs otherwise.
+	// +optional
+	Endpoints []string `json:"endpoints,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.size,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.spec.size`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+// +kubebuilder:printcolumn:name="Available",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Memcached is the Schema for the memcacheds API
 type Memcached struct {
@@ -0,0 +1,158 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	cachev1alpha1 "github.com/example/operatorsdk-memcached/api/v1alpha1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// defaultTargetCPUUtilizationPercentage is used when neither a CPU nor a custom metric target is set
+const defaultTargetCPUUtilizationPercentage = 80
+
+// replicasForMemcached returns the replicas of a new workload.
+// With spec.autoscaling, spec.size is clamped to the min and max replicas of the HorizontalPodAutoscaler.
+func replicasForMemcached(m *cachev1alpha1.Memcached) int32 {
+	replicas := m.Spec.Size
+	as := m.Spec.Autoscaling
+	if as == nil {
+		return replicas
+	}
+	if as.MinReplicas != nil && replicas < *as.MinReplicas {
+		replicas = *as.MinReplicas
+	}
+	if replicas < 1 {
+		replicas = 1
+	}
+	if replicas > as.MaxReplicas {
+		replicas = as.MaxReplicas
+	}
+	return replicas
+}
+
+// reconcileHorizontalPodAutoscaler ensures the HorizontalPodAutoscaler is the same as spec.autoscaling.
+// It returns a *conflictError if the HorizontalPodAutoscaler exists and is not controlled by m.
+func (r *MemcachedReconciler) reconcileHorizontalPodAutoscaler(ctx context.Context, m *cachev1alpha1.Memcached) error {
+	logger := log.FromContext(ctx)
+
+	found := &autoscalingv2.HorizontalPodAutoscaler{}
+	err := r.Get(ctx, types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if m.Spec.Autoscaling == nil {
+		// spec.autoscalingが外された場合は、Memcachedが所有しているHPAだけを削除する（以降はspec.sizeでreplicasを管理）
+		if !exists || !metav1.IsControlledBy(found, m) {
+			return nil
+		}
+		logger.Info("Deleting HorizontalPodAutoscaler", "HorizontalPodAutoscaler.Namespace", found.Namespace, "HorizontalPodAutoscaler.Name", found.Name)
+		return client.IgnoreNotFound(r.Delete(ctx, found))
+	}
+
+	desired := r.horizontalPodAutoscalerForMemcached(m)
+	if !exists {
+		logger.Info("Creating a new HorizontalPodAutoscaler", "HorizontalPodAutoscaler.Namespace", desired.Namespace, "HorizontalPodAutoscaler.Name", desired.Name)
+		return r.Create(ctx, desired)
+	}
+	// 所有していないHPAは上書きしない
+	if !metav1.IsControlledBy(found, m) {
+		return &conflictError{kind: "HorizontalPodAutoscaler", name: found.Name}
+	}
+	if equality.Semantic.DeepEqual(found.Spec, desired.Spec) {
+		return nil
+	}
+	found.Spec = desired.Spec
+	logger.Info("Updating HorizontalPodAutoscaler", "HorizontalPodAutoscaler.Namespace", found.Namespace, "HorizontalPodAutoscaler.Name", found.Name)
+	return r.Update(ctx, found)
+}
+
+// horizontalPodAutoscalerForMemcached returns a HorizontalPodAutoscaler scaling the workload of the current spec.workloadType
+func (r *MemcachedReconciler) horizontalPodAutoscalerForMemcached(m *cachev1alpha1.Memcached) *autoscalingv2.HorizontalPodAutoscaler {
+	as := m.Spec.Autoscaling
+	minReplicas := int32(1)
+	if as.MinReplicas != nil {
+		minReplicas = *as.MinReplicas
+	}
+	kind := string(cachev1alpha1.WorkloadTypeDeployment)
+	if m.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+		kind = string(cachev1alpha1.WorkloadTypeStatefulSet)
+	}
+
+	var metrics []autoscalingv2.MetricSpec
+	if as.TargetCPUUtilizationPercentage != nil || as.CustomMetric == nil {
+		utilization := int32(defaultTargetCPUUtilizationPercentage)
+		if as.TargetCPUUtilizationPercentage != nil {
+			utilization = *as.TargetCPUUtilizationPercentage
+		}
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &utilization,
+				},
+			},
+		})
+	}
+	if as.CustomMetric != nil {
+		averageValue := as.CustomMetric.AverageValue.DeepCopy()
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{Name: as.CustomMetric.Name},
+				Target: autoscalingv2.MetricTarget{
+					Type:         autoscalingv2.AverageValueMetricType,
+					AverageValue: &averageValue,
+				},
+			},
+		})
+	}
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+			Labels:    labelsForMemcached(m.Name),
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       kind,
+				Name:       m.Name,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: as.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, hpa, r.Scheme)
+	return hpa
+}
@@ -18,31 +18,65 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"reflect"
+	"sort"
 
 	cachev1alpha1 "github.com/example/operatorsdk-memcached/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// defaultImage and defaultMemoryLimitMB are used when the spec omits them (same as the CRD defaults)
+	defaultImage         = "memcached:1.4.36-alpine"
+	defaultMemoryLimitMB = 64
+	memcachedPort        = 11211
+
+	// templateHashAnnotation holds the hash of the pod template generated from the Memcached spec
+	templateHashAnnotation = "cache.example.com/template-hash"
 )
 
 // MemcachedReconciler reconciles a Memcached object
 type MemcachedReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// ServiceMonitorAvailable enables the ServiceMonitors of spec.monitoring.
+	// It must only be set if the ServiceMonitor CRD is installed.
+	ServiceMonitorAvailable bool
+	Recorder                record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=cache.example.com,resources=memcacheds,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cache.example.com,resources=memcacheds/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cache.example.com,resources=memcacheds/finalizers,verbs=update
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -70,41 +104,98 @@ func (r *MemcachedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	}
 	logger.Info("1. Fetch the Memcached instance. Memchached resource found", "memcached.Name", memcached.Name, "memcached.Namespace", memcached.Namespace)
 
-	// 2. Check if the deployment already exists, if not create a new one
-	found := &appsv1.Deployment{}
-	// memcachedのNameとNamespaceと一致するDeploymentを見つける
-	err = r.Get(ctx, types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, found)
-	if err != nil && errors.IsNotFound(err) {
-		// Define a new deployment
-		dep := r.deploymentForMemcached(memcached)
-		logger.Info("2. Check if the deployment already exists, if not create a new one. Creating a new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
-		err = r.Create(ctx, dep)
-		if err != nil {
-			logger.Error(err, "2. Check if the deployment already exists, if not create a new one. Failed to create new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+	// Memcachedが削除中の場合は、Podを停止してからワークロードを削除し、finalizerを外す
+	if !memcached.DeletionTimestamp.IsZero() {
+		return r.finalizeMemcached(ctx, memcached)
+	}
+	if !controllerutil.ContainsFinalizer(memcached, memcachedFinalizer) {
+		controllerutil.AddFinalizer(memcached, memcachedFinalizer)
+		if err = r.Update(ctx, memcached); err != nil {
+			logger.Error(err, "Failed to add finalizer")
 			return ctrl.Result{}, err
 		}
-		// Deployment created successfully
+		// Memcachedの更新で再度Reconcileされる
+		return ctrl.Result{}, nil
+	}
+
+	// spec.authとspec.tlsで参照しているSecretを検証する。ない場合はワークロードを変更せずに、Secretの作成・変更を待つ
+	secretHash, err := r.secretHash(ctx, memcached)
+	if serr, ok := err.(*secretError); ok {
+		logger.Info("Referenced Secret is not ready", "reason", serr.reason, "message", serr.message)
+		original := memcached.Status.DeepCopy()
+		setCondition(memcached, cachev1alpha1.ConditionDegraded, metav1.ConditionTrue, serr.reason, serr.message)
+		if !reflect.DeepEqual(original, &memcached.Status) {
+			return ctrl.Result{}, r.Status().Update(ctx, memcached)
+		}
 		return ctrl.Result{}, nil
 	} else if err != nil {
-		logger.Error(err, "2. Check if the deployment already exists, if not create a new one. Failed to get Deployment")
+		logger.Error(err, "Failed to get the referenced Secrets")
+		return ctrl.Result{}, err
+	}
+	if err = r.reconcileSASLConfigMap(ctx, memcached); err != nil {
+		if cerr, ok := err.(*conflictError); ok {
+			return r.reportConflict(ctx, memcached, cerr)
+		}
+		logger.Error(err, "Failed to reconcile SASL ConfigMap")
 		return ctrl.Result{}, err
 	}
 
-	// 3. Ensure the deployment size is the same as the spec
-	size := memcached.Spec.Size
-	if *found.Spec.Replicas != size {
-		found.Spec.Replicas = &size
-		err = r.Update(ctx, found)
-		if err != nil {
-			logger.Error(err, "3. Ensure the deployment size is the same as the spec. Failed to update Deployment", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
-			return ctrl.Result{}, err
+	// 2. Ensure the services are the same as the spec
+	// StatefulSetのPodのDNS名はheadless Serviceで解決されるため、ワークロードより先に作成する
+	if err = r.reconcileServices(ctx, memcached); err != nil {
+		if cerr, ok := err.(*conflictError); ok {
+			return r.reportConflict(ctx, memcached, cerr)
 		}
-		// Spec updated - return and requeue
-		logger.Info("3. Ensure the deployment size is the same as the spec. Update deployment size", "Deployment.Spec.Replicas", size)
-		return ctrl.Result{}, nil
+		logger.Error(err, "2. Ensure the services are the same as the spec. Failed to reconcile Services")
+		return ctrl.Result{}, err
 	}
 
-	// 4. Update the Memcached status with the pod names
+	// ServiceMonitorはheadless Serviceのmetricsポートを監視する
+	if err = r.reconcileServiceMonitor(ctx, memcached); err != nil {
+		if cerr, ok := err.(*conflictError); ok {
+			return r.reportConflict(ctx, memcached, cerr)
+		}
+		logger.Error(err, "2. Ensure the services are the same as the spec. Failed to reconcile ServiceMonitor")
+		return ctrl.Result{}, err
+	}
+
+	// spec.autoscalingとspec.podDisruptionBudgetに応じてHPAとPodDisruptionBudgetを作成・更新・削除する
+	if err = r.reconcileHorizontalPodAutoscaler(ctx, memcached); err != nil {
+		if cerr, ok := err.(*conflictError); ok {
+			return r.reportConflict(ctx, memcached, cerr)
+		}
+		logger.Error(err, "Failed to reconcile HorizontalPodAutoscaler")
+		return ctrl.Result{}, err
+	}
+	if err = r.reconcilePodDisruptionBudget(ctx, memcached); err != nil {
+		if cerr, ok := err.(*conflictError); ok {
+			return r.reportConflict(ctx, memcached, cerr)
+		}
+		logger.Error(err, "Failed to reconcile PodDisruptionBudget")
+		return ctrl.Result{}, err
+	}
+
+	// 3. Check if the workload already exists, if not create a new one, and
+	// 4. Ensure the workload is the same as the spec
+	// spec.workloadTypeに応じてDeploymentかStatefulSetを作成・更新する（変更した場合はその変更の監視で再度Reconcileされる）
+	var changed bool
+	if memcached.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+		changed, err = r.reconcileStatefulSet(ctx, memcached, secretHash)
+	} else {
+		changed, err = r.reconcileDeployment(ctx, memcached, secretHash)
+	}
+	if err != nil || changed {
+		return ctrl.Result{}, err
+	}
+
+	// 5. Remove the workload of the previous workloadType once the current one is ready
+	// 移行中にキャッシュが全て失われないように、新しいワークロードのPodがReadyになってから古いワークロードを削除する
+	if err = r.removePreviousWorkload(ctx, memcached); err != nil {
+		logger.Error(err, "5. Remove the workload of the previous workloadType. Failed to remove the previous workload")
+		return ctrl.Result{}, err
+	}
+
+	// 6. Update the Memcached status with the pod names
 	// List the pods for this memcached's deployment
 	podList := &corev1.PodList{}
 	listOpts := []client.ListOption{
@@ -112,64 +203,119 @@ func (r *MemcachedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		client.MatchingLabels(labelsForMemcached(memcached.Name)),
 	}
 	if err = r.List(ctx, podList, listOpts...); err != nil {
-		logger.Error(err, "4. Update the Memcached status with the pod names. Failed to list pods", "Memcached.Namespace", memcached.Namespace, "Memcached.Name", memcached.Name)
+		logger.Error(err, "6. Update the Memcached status with the pod names. Failed to list pods", "Memcached.Namespace", memcached.Namespace, "Memcached.Name", memcached.Name)
+		return ctrl.Result{}, err
+	}
+	workload, err := r.getWorkloadStatus(ctx, memcached)
+	if err != nil {
+		logger.Error(err, "6. Update the Memcached status with the pod names. Failed to get the workload")
 		return ctrl.Result{}, err
 	}
-	podNames := getPodNames(podList.Items)
-	logger.Info("4. Update the Memcached status with the pod names. Pod list", "podNames", podNames)
-	// Update status.Nodes if needed
-	if !reflect.DeepEqual(podNames, memcached.Status.Nodes) {
-		memcached.Status.Nodes = podNames
+	// Update status.Nodes, status.Conditions etc. if needed
+	// status.nodesにはReadyなPodだけを含める
+	original := memcached.Status.DeepCopy()
+	setStatus(memcached, workload, podList.Items)
+	logger.Info("6. Update the Memcached status with the pod names. Pod list", "podNames", memcached.Status.Nodes)
+	if !reflect.DeepEqual(original, &memcached.Status) {
 		err := r.Status().Update(ctx, memcached)
 		if err != nil {
-			logger.Error(err, "4. Update the Memcached status with the pod names. Failed to update Memcached status")
+			logger.Error(err, "6. Update the Memcached status with the pod names. Failed to update Memcached status")
 			return ctrl.Result{}, err
 		}
 	}
-	logger.Info("4. Update the Memcached status with the pod names. Update memcached.Status", "memcached.Status.Nodes", memcached.Status.Nodes)
+	logger.Info("6. Update the Memcached status with the pod names. Update memcached.Status", "memcached.Status.Nodes", memcached.Status.Nodes)
 
 	return ctrl.Result{}, nil
 }
 
+// reconcileDeployment creates the Deployment if it does not exist, or updates it to match the spec.
+// It reports whether the Deployment was changed.
+func (r *MemcachedReconciler) reconcileDeployment(ctx context.Context, memcached *cachev1alpha1.Memcached, secretHash string) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	// 3. Check if the deployment already exists, if not create a new one
+	found := &appsv1.Deployment{}
+	// memcachedのNameとNamespaceと一致するDeploymentを見つける
+	err := r.Get(ctx, types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		// Define a new deployment
+		dep := r.deploymentForMemcached(memcached, secretHash)
+		logger.Info("3. Check if the deployment already exists, if not create a new one. Creating a new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+		err = r.Create(ctx, dep)
+		if err != nil {
+			logger.Error(err, "3. Check if the deployment already exists, if not create a new one. Failed to create new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			return false, err
+		}
+		// Deployment created successfully
+		r.Recorder.Eventf(memcached, corev1.EventTypeNormal, eventCreated, "Created Deployment %s", dep.Name)
+		return true, nil
+	} else if err != nil {
+		logger.Error(err, "3. Check if the deployment already exists, if not create a new one. Failed to get Deployment")
+		return false, err
+	}
+
+	// 4. Ensure the deployment is the same as the spec
+	// replicasに加えて、image・コマンドライン・resourcesなどPodテンプレートが変わった場合もDeploymentを更新してロールアウトする
+	desired := r.deploymentForMemcached(memcached, secretHash)
+	if memcached.Spec.Autoscaling != nil {
+		// HPAと取り合いにならないように、spec.autoscalingがある場合はreplicasを変更しない
+		desired.Spec.Replicas = found.Spec.Replicas
+	}
+	previous := found.Spec.Replicas
+	if updateDeployment(found, desired) {
+		err = r.Update(ctx, found)
+		if err != nil {
+			logger.Error(err, "4. Ensure the deployment is the same as the spec. Failed to update Deployment", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+			return false, err
+		}
+		r.recordScaled(memcached, found, previous, found.Spec.Replicas)
+		// Spec updated - return and requeue
+		logger.Info("4. Ensure the deployment is the same as the spec. Update deployment", "Deployment.Spec.Replicas", *found.Spec.Replicas, "templateHash", found.Annotations[templateHashAnnotation])
+		return true, nil
+	}
+	return false, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *MemcachedReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr)
+	// ServiceMonitorのCRDがない場合はinformerを起動できないため、ある場合だけ監視する
+	if r.ServiceMonitorAvailable {
+		b = b.Owns(newServiceMonitor())
+	}
+	return b.
 		For(&cachev1alpha1.Memcached{}). // 対象になるプライマリーリソースを指定
 		Owns(&appsv1.Deployment{}).      // セカンダリリソースを指定。セカンダリリソースの作成、更新、削除が行われた際に、そのオーナー(memcached)に対して(reqがオーナーになる)Reconcileループが呼ばれる。
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Owns(&corev1.ConfigMap{}).
+		// spec.authとspec.tlsで参照しているSecretが作成・変更されたらPodをロールアウトするため監視する
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.memcachedsForSecret)).
+		// PodのReady状態などが変わったらstatus.nodesを更新するため、memcached_crラベルでMemcachedに対応付けて監視する
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.memcachedForPod), builder.WithPredicates(podPredicate())).
 		Complete(r)
 }
 
 // deploymentForMemcached returns a memcached Deployment object
-func (r *MemcachedReconciler) deploymentForMemcached(m *cachev1alpha1.Memcached) *appsv1.Deployment {
+func (r *MemcachedReconciler) deploymentForMemcached(m *cachev1alpha1.Memcached, secretHash string) *appsv1.Deployment {
 	ls := labelsForMemcached(m.Name)
-	replicas := m.Spec.Size
+	replicas := replicasForMemcached(m)
+	template := podTemplateForMemcached(m, secretHash)
 
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      m.Name,
-			Namespace: m.Namespace,
+			Name:        m.Name,
+			Namespace:   m.Namespace,
+			Annotations: map[string]string{templateHashAnnotation: templateHash(&template)},
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: ls,
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{{
-						Image:   "memcached:1.4.36-alpine",
-						Name:    "memcached",
-						Command: []string{"memcached", "-m=64", "-o", "modern", "-v"},
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: 11211,
-							Name:          "memcached",
-						}},
-					}},
-				},
-			},
+			Template: template,
 		},
 	}
 	// Set Memcached instance as the owner and controller
@@ -177,17 +323,138 @@ func (r *MemcachedReconciler) deploymentForMemcached(m *cachev1alpha1.Memcached)
 	return dep
 }
 
+// spreadAcrossZones adds a topology spread constraint over zones and a preferred pod anti-affinity
+// over nodes for the pods selected by ls to the pod spec
+func spreadAcrossZones(spec *corev1.PodSpec, ls map[string]string) {
+	selector := &metav1.LabelSelector{MatchLabels: ls}
+	// ゾーンのラベルがないノードでもスケジュールできるように、どちらも必須ではなく優先にする
+	spec.TopologySpreadConstraints = append(spec.TopologySpreadConstraints, corev1.TopologySpreadConstraint{
+		MaxSkew:           1,
+		TopologyKey:       corev1.LabelTopologyZone,
+		WhenUnsatisfiable: corev1.ScheduleAnyway,
+		LabelSelector:     selector,
+	})
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.PodAntiAffinity == nil {
+		spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	antiAffinity := spec.Affinity.PodAntiAffinity
+	antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, corev1.WeightedPodAffinityTerm{
+		Weight: 100,
+		PodAffinityTerm: corev1.PodAffinityTerm{
+			LabelSelector: selector,
+			TopologyKey:   corev1.LabelHostname,
+		},
+	})
+}
+
+// podTemplateForMemcached returns the memcached pod template shared by the Deployment and the StatefulSet.
+// secretHash is the hash of the Secrets referenced by spec.auth and spec.tls.
+func podTemplateForMemcached(m *cachev1alpha1.Memcached, secretHash string) corev1.PodTemplateSpec {
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labelsForMemcached(m.Name),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image:     memcachedImage(m),
+				Name:      "memcached",
+				Command:   memcachedCommand(m),
+				Resources: m.Spec.Resources,
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: memcachedPort,
+					Name:          "memcached",
+				}},
+			}},
+		},
+	}
+	template.Spec.Affinity = m.Spec.Affinity.DeepCopy()
+	template.Spec.Tolerations = m.Spec.Tolerations
+	template.Spec.NodeSelector = m.Spec.NodeSelector
+	template.Spec.PriorityClassName = m.Spec.PriorityClassName
+	if m.Spec.SpreadAcrossZones {
+		spreadAcrossZones(&template.Spec, labelsForMemcached(m.Name))
+	}
+	configureSecurity(&template, m, secretHash)
+	// spec.monitoring.enabledの場合はmemcached-exporterをサイドカーとして追加
+	if m.Spec.Monitoring.Enabled {
+		template.Spec.Containers = append(template.Spec.Containers, exporterContainer(m))
+	}
+	return template
+}
+
+// memcachedImage returns the memcached container image of the spec
+func memcachedImage(m *cachev1alpha1.Memcached) string {
+	if m.Spec.Image == "" {
+		return defaultImage
+	}
+	return m.Spec.Image
+}
+
+// memcachedCommand returns the memcached command line derived from the spec
+func memcachedCommand(m *cachev1alpha1.Memcached) []string {
+	memory := m.Spec.MemoryLimitMB
+	if memory == 0 {
+		memory = defaultMemoryLimitMB
+	}
+	command := []string{"memcached", fmt.Sprintf("-m=%d", memory), "-o", "modern", "-v"}
+	if m.Spec.MaxConnections > 0 {
+		command = append(command, fmt.Sprintf("-c=%d", m.Spec.MaxConnections))
+	}
+	if m.Spec.Threads > 0 {
+		command = append(command, fmt.Sprintf("-t=%d", m.Spec.Threads))
+	}
+	command = append(command, securityArgs(m)...)
+	return append(command, m.Spec.ExtraArgs...)
+}
+
+// templateHash returns the hash of the pod template generated from the spec.
+// APIサーバーがデフォルト値を補完したテンプレートと比較すると常に差分が出るため、生成したテンプレートのハッシュで比較する
+func templateHash(template *corev1.PodTemplateSpec) string {
+	b, _ := json.Marshal(template)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// updateDeployment copies the replicas and the pod template of desired to found
+// if they differ, and reports whether found was changed
+func updateDeployment(found, desired *appsv1.Deployment) bool {
+	changed := false
+	if found.Spec.Replicas == nil || *found.Spec.Replicas != *desired.Spec.Replicas {
+		found.Spec.Replicas = desired.Spec.Replicas
+		changed = true
+	}
+	hash := desired.Annotations[templateHashAnnotation]
+	if found.Annotations[templateHashAnnotation] != hash {
+		found.Spec.Template = desired.Spec.Template
+		if found.Annotations == nil {
+			found.Annotations = map[string]string{}
+		}
+		found.Annotations[templateHashAnnotation] = hash
+		changed = true
+	}
+	return changed
+}
+
 // labelsForMemcached returns the labels for selecting the resources
 // belonging to the given memcached CR name.
 func labelsForMemcached(name string) map[string]string {
-	return map[string]string{"app": "memcached", "memcached_cr": name}
+	return map[string]string{"app": "memcached", memcachedCRLabel: name}
 }
 
-// getPodNames returns the pod names of the array of pods passed in
+// getPodNames returns the names of the ready pods of the array of pods passed in.
+// Pending, Terminating and CrashLooping pods are excluded.
 func getPodNames(pods []corev1.Pod) []string {
-	var podNames []string
+	// status.nodesは必須フィールドのため、Podがない場合もnilではなく空のスライスを返す
+	podNames := []string{}
 	for _, pod := range pods {
+		if !isPodReady(&pod) {
+			continue
+		}
 		podNames = append(podNames, pod.Name)
 	}
+	sort.Strings(podNames)
 	return podNames
 }
@@ -5,8 +5,16 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"time"
 )
 
@@ -22,9 +30,13 @@ const (
 var _ = Describe("MemcachedController", func() {
 	// 各コンテキストの前にCleanup処理を入れないと前のコンテキストで作成したオブジェクトが残っていて、同じNameSpace, Nameで作れないエラーが発生
 	BeforeEach(func() {
+		// Clean up Pods
+		// finalizerは全てのPodが終了するまでMemcachedの削除を待つため、先にPodを削除する
+		err := k8sClient.DeleteAllOf(ctx, &corev1.Pod{}, client.InNamespace(memcachedNamespace), client.MatchingLabels{"memcached_cr": memcachedName}, client.GracePeriodSeconds(0))
+		Expect(err).NotTo(HaveOccurred())
 		// Clean up Memcached
 		memcached := &cachev1alpha1.Memcached{}
-		err := k8sClient.Get(
+		err = k8sClient.Get(
 			ctx,
 			types.NamespacedName{
 				Namespace: memcachedNamespace,
@@ -35,6 +47,17 @@ var _ = Describe("MemcachedController", func() {
 			err := k8sClient.Delete(ctx, memcached)
 			Expect(err).NotTo(HaveOccurred())
 		}
+		// finalizerの処理が終わってMemcachedが削除されるまで待つ
+		Eventually(func() bool {
+			err := k8sClient.Get(
+				ctx,
+				types.NamespacedName{
+					Namespace: memcachedNamespace,
+					Name:      memcachedName,
+				},
+				memcached)
+			return errors.IsNotFound(err)
+		}, timeout, interval).Should(BeTrue())
 		// Clean up Deployment
 		deployment := &appsv1.Deployment{}
 		err = k8sClient.Get(
@@ -46,7 +69,77 @@ var _ = Describe("MemcachedController", func() {
 			deployment)
 		if err == nil {
 			err := k8sClient.Delete(ctx, deployment)
-			Expect(err).NotTo(HaveOccurred())
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+		}
+		// Clean up StatefulSet
+		statefulSet := &appsv1.StatefulSet{}
+		err = k8sClient.Get(
+			ctx,
+			types.NamespacedName{
+				Namespace: memcachedNamespace,
+				Name:      memcachedName,
+			},
+			statefulSet)
+		if err == nil {
+			err := k8sClient.Delete(ctx, statefulSet)
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+		}
+		// Clean up Services（envtestではガベージコレクタが動かないため）
+		for _, name := range []string{memcachedName, memcachedName + "-headless"} {
+			service := &corev1.Service{}
+			err = k8sClient.Get(
+				ctx,
+				types.NamespacedName{
+					Namespace: memcachedNamespace,
+					Name:      name,
+				},
+				service)
+			if err == nil {
+				err := k8sClient.Delete(ctx, service)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+		// Clean up TLS and SASL Secrets
+		for _, name := range []string{memcachedName + "-tls", memcachedName + "-auth"} {
+			secret := &corev1.Secret{}
+			err = k8sClient.Get(
+				ctx,
+				types.NamespacedName{
+					Namespace: memcachedNamespace,
+					Name:      name,
+				},
+				secret)
+			if err == nil {
+				err := k8sClient.Delete(ctx, secret)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+		// Clean up SASL ConfigMap
+		configMap := &corev1.ConfigMap{}
+		err = k8sClient.Get(
+			ctx,
+			types.NamespacedName{
+				Namespace: memcachedNamespace,
+				Name:      memcachedName + "-sasl",
+			},
+			configMap)
+		if err == nil {
+			err := k8sClient.Delete(ctx, configMap)
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+		}
+		// Clean up HorizontalPodAutoscaler and PodDisruptionBudget
+		for _, obj := range []client.Object{&autoscalingv2.HorizontalPodAutoscaler{}, &policyv1.PodDisruptionBudget{}} {
+			err = k8sClient.Get(
+				ctx,
+				types.NamespacedName{
+					Namespace: memcachedNamespace,
+					Name:      memcachedName,
+				},
+				obj)
+			if err == nil {
+				err := k8sClient.Delete(ctx, obj)
+				Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+			}
 		}
 	})
 
@@ -149,6 +242,936 @@ var _ = Describe("MemcachedController", func() {
 		})
 	})
 
+	// Memcachedのimageやmemcachedのオプションを更新するとDeploymentのPodテンプレートも更新されることをテスト
+	Context("When Memcached's image and flags are updated", func() {
+		It("Deployment's pod template should be updated", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 1,
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			// デフォルトのimageとコマンドラインでDeploymentが作成されることをテスト
+			deployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					deployment)
+			}, timeout, interval).Should(BeNil())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("memcached:1.4.36-alpine"))
+			Expect(deployment.Spec.Template.Spec.Containers[0].Command).To(Equal([]string{"memcached", "-m=64", "-o", "modern", "-v"}))
+
+			// imageとmemcachedのオプションを更新
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}, memcached)
+			Expect(err).NotTo(HaveOccurred())
+			memcached.Spec.Image = "memcached:1.6.21-alpine"
+			memcached.Spec.MemoryLimitMB = 128
+			memcached.Spec.MaxConnections = 2048
+			memcached.Spec.Threads = 8
+			memcached.Spec.ExtraArgs = []string{"-I=2m"}
+			err = k8sClient.Update(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() []string {
+				err := k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					deployment)
+				if err != nil {
+					return nil
+				}
+				return deployment.Spec.Template.Spec.Containers[0].Command
+			}, timeout, interval).Should(Equal([]string{"memcached", "-m=128", "-o", "modern", "-v", "-c=2048", "-t=8", "-I=2m"}))
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("memcached:1.6.21-alpine"))
+		})
+	})
+
+	// headless Serviceと、spec.service.clusterIPが有効な場合はClusterIP Serviceが作成されることをテスト
+	Context("When Memcached is created with a ClusterIP Service", func() {
+		It("Services should be created and the ClusterIP Service deleted when disabled", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size:    1,
+					Service: cachev1alpha1.ServiceSpec{ClusterIP: true},
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			headless := &corev1.Service{}
+			Eventually(func() error {
+				return k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName + "-headless",
+						Namespace: memcachedNamespace,
+					},
+					headless)
+			}, timeout, interval).Should(BeNil())
+			Expect(headless.Spec.ClusterIP).To(Equal(corev1.ClusterIPNone))
+
+			service := &corev1.Service{}
+			Eventually(func() error {
+				return k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					service)
+			}, timeout, interval).Should(BeNil())
+			Expect(service.Spec.ClusterIP).NotTo(Equal(corev1.ClusterIPNone))
+
+			// spec.service.clusterIPを無効にするとClusterIP Serviceが削除される
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}, memcached)
+			Expect(err).NotTo(HaveOccurred())
+			memcached.Spec.Service.ClusterIP = false
+			err = k8sClient.Update(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() bool {
+				err := k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					service)
+				return errors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	// 所有していない同名のServiceが上書きされず、Degraded conditionで報告されることをテスト
+	Context("When a Service with the headless Service's name already exists", func() {
+		It("the Service should be kept and the conflict reported", func() {
+			other := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName + "-headless",
+					Namespace: memcachedNamespace,
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "other"},
+					Ports:    []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 8080}},
+				},
+			}
+			err := k8sClient.Create(ctx, other)
+			Expect(err).NotTo(HaveOccurred())
+
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 1,
+				},
+			}
+			err = k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			key := types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}
+			Eventually(func() string {
+				err := k8sClient.Get(ctx, key, memcached)
+				if err != nil {
+					return ""
+				}
+				condition := meta.FindStatusCondition(memcached.Status.Conditions, cachev1alpha1.ConditionDegraded)
+				if condition == nil || condition.Status != metav1.ConditionTrue {
+					return ""
+				}
+				return condition.Reason
+			}, timeout, interval).Should(Equal(reasonResourceConflict))
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(other), other)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other.Spec.Selector).To(Equal(map[string]string{"app": "other"}))
+			Expect(other.Spec.Ports).To(HaveLen(1))
+			Expect(other.OwnerReferences).To(BeEmpty())
+		})
+	})
+
+	// 所有していない同名のHPAとPodDisruptionBudgetが上書きされず、Degraded conditionで報告されることをテスト
+	Context("When a HorizontalPodAutoscaler or PodDisruptionBudget with the Memcached's name already exists", func() {
+		expectConflict := func(spec cachev1alpha1.MemcachedSpec, kind string) {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: spec,
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			key := types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}
+			Eventually(func() *metav1.Condition {
+				err := k8sClient.Get(ctx, key, memcached)
+				if err != nil {
+					return nil
+				}
+				return meta.FindStatusCondition(memcached.Status.Conditions, cachev1alpha1.ConditionDegraded)
+			}, timeout, interval).Should(And(
+				HaveField("Status", metav1.ConditionTrue),
+				HaveField("Reason", reasonResourceConflict),
+				HaveField("Message", ContainSubstring(kind)),
+			))
+		}
+
+		It("the HorizontalPodAutoscaler should be kept and the conflict reported", func() {
+			other := &autoscalingv2.HorizontalPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "other"},
+					MaxReplicas:    3,
+				},
+			}
+			err := k8sClient.Create(ctx, other)
+			Expect(err).NotTo(HaveOccurred())
+
+			expectConflict(cachev1alpha1.MemcachedSpec{
+				Size: 1,
+				Autoscaling: &cachev1alpha1.AutoscalingSpec{
+					MaxReplicas: 4,
+					CustomMetric: &cachev1alpha1.CustomMetricTarget{
+						Name:         "memcached_current_connections",
+						AverageValue: resource.MustParse("100"),
+					},
+				},
+			}, "HorizontalPodAutoscaler")
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(other), other)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other.Spec.ScaleTargetRef.Name).To(Equal("other"))
+			Expect(other.Spec.MaxReplicas).To(Equal(int32(3)))
+			Expect(other.OwnerReferences).To(BeEmpty())
+		})
+
+		It("the PodDisruptionBudget should be kept and the conflict reported", func() {
+			maxUnavailable := intstr.FromInt(2)
+			other := &policyv1.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: policyv1.PodDisruptionBudgetSpec{
+					Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}},
+					MaxUnavailable: &maxUnavailable,
+				},
+			}
+			err := k8sClient.Create(ctx, other)
+			Expect(err).NotTo(HaveOccurred())
+
+			expectConflict(cachev1alpha1.MemcachedSpec{
+				Size:                1,
+				PodDisruptionBudget: &cachev1alpha1.PodDisruptionBudgetSpec{},
+			}, "PodDisruptionBudget")
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(other), other)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": "other"}))
+			Expect(other.Spec.MaxUnavailable).To(Equal(&maxUnavailable))
+			Expect(other.OwnerReferences).To(BeEmpty())
+		})
+	})
+
+	// spec.workloadTypeをStatefulSetに変更すると、StatefulSetがReadyになってからDeploymentが削除されることをテスト
+	Context("When Memcached's workloadType is changed to StatefulSet", func() {
+		It("Deployment should be deleted after the StatefulSet is ready", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 2,
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			key := types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}
+			deployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, key, deployment)
+			}, timeout, interval).Should(BeNil())
+
+			// spec.workloadTypeをStatefulSetに変更
+			err = k8sClient.Get(ctx, key, memcached)
+			Expect(err).NotTo(HaveOccurred())
+			memcached.Spec.WorkloadType = cachev1alpha1.WorkloadTypeStatefulSet
+			err = k8sClient.Update(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			statefulSet := &appsv1.StatefulSet{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, key, statefulSet)
+			}, timeout, interval).Should(BeNil())
+			Expect(statefulSet.Spec.ServiceName).To(Equal(memcachedName + "-headless"))
+			Expect(*statefulSet.Spec.Replicas).To(Equal(int32(2)))
+
+			// StatefulSetのPodがReadyになるまではDeploymentを残す
+			Consistently(func() error {
+				return k8sClient.Get(ctx, key, deployment)
+			}, time.Second, interval).Should(BeNil())
+
+			// envtestではPodが起動しないため、StatefulSetのstatusを直接更新する
+			statefulSet.Status.ObservedGeneration = statefulSet.Generation
+			statefulSet.Status.Replicas = 2
+			statefulSet.Status.ReadyReplicas = 2
+			err = k8sClient.Status().Update(ctx, statefulSet)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, key, deployment)
+				return errors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	// statusにconditionsとobservedGenerationが記録されることをテスト
+	Context("When Memcached is reconciled", func() {
+		It("status should report the conditions", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 1,
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			// envtestではPodが起動しないため、Availableにはならずロールアウト中のまま
+			key := types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}
+			Eventually(func() int64 {
+				err := k8sClient.Get(ctx, key, memcached)
+				if err != nil {
+					return 0
+				}
+				return memcached.Status.ObservedGeneration
+			}, timeout, interval).Should(Equal(memcached.Generation))
+			Expect(memcached.Status.Nodes).To(BeEmpty())
+			Expect(memcached.Status.ReadyReplicas).To(Equal(int32(0)))
+			Expect(meta.IsStatusConditionFalse(memcached.Status.Conditions, cachev1alpha1.ConditionAvailable)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(memcached.Status.Conditions, cachev1alpha1.ConditionProgressing)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(memcached.Status.Conditions, cachev1alpha1.ConditionDegraded)).To(BeTrue())
+		})
+	})
+
+	// PodのReady状態が変わるとstatus.nodesが更新されることをテスト
+	Context("When a memcached pod becomes ready", func() {
+		It("status.nodes should be updated", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 1,
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			key := types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}
+			Eventually(func() int64 {
+				err := k8sClient.Get(ctx, key, memcached)
+				if err != nil {
+					return 0
+				}
+				return memcached.Status.ObservedGeneration
+			}, timeout, interval).Should(Equal(memcached.Generation))
+
+			// envtestではPodが起動しないため、Deploymentが作成するはずのPodを作成してstatusを直接更新する
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName + "-pod",
+					Namespace: memcachedNamespace,
+					Labels:    map[string]string{"app": "memcached", "memcached_cr": memcachedName},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "memcached", Image: "memcached:1.4.36-alpine"}},
+				},
+			}
+			err = k8sClient.Create(ctx, pod)
+			Expect(err).NotTo(HaveOccurred())
+			pod.Status = corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				PodIP:      "10.0.0.1",
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			}
+			err = k8sClient.Status().Update(ctx, pod)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() []string {
+				err := k8sClient.Get(ctx, key, memcached)
+				if err != nil {
+					return nil
+				}
+				return memcached.Status.Nodes
+			}, timeout, interval).Should(Equal([]string{pod.Name}))
+			Expect(memcached.Status.Endpoints).To(Equal([]string{"10.0.0.1:11211"}))
+			Expect(memcached.Status.ReadyReplicas).To(Equal(int32(1)))
+
+			// PodがReadyでなくなるとstatus.nodesから除かれる
+			pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}
+			err = k8sClient.Status().Update(ctx, pod)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() []string {
+				err := k8sClient.Get(ctx, key, memcached)
+				if err != nil {
+					return nil
+				}
+				return memcached.Status.Nodes
+			}, timeout, interval).Should(BeEmpty())
+		})
+	})
+
+	// spec.monitoring.enabledの場合、exporterサイドカーとheadless Serviceのmetricsポートが追加されることをテスト
+	Context("When Memcached is created with monitoring enabled", func() {
+		It("exporter sidecar and metrics port should be added", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size:       1,
+					Monitoring: cachev1alpha1.MonitoringSpec{Enabled: true},
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					deployment)
+			}, timeout, interval).Should(BeNil())
+			containers := deployment.Spec.Template.Spec.Containers
+			Expect(containers).To(HaveLen(2))
+			Expect(containers[1].Name).To(Equal("exporter"))
+			Expect(containers[1].Image).To(Equal("prom/memcached-exporter:v0.13.0"))
+			Expect(containers[1].Ports[0].ContainerPort).To(Equal(int32(9150)))
+
+			headless := &corev1.Service{}
+			Eventually(func() error {
+				return k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName + "-headless",
+						Namespace: memcachedNamespace,
+					},
+					headless)
+			}, timeout, interval).Should(BeNil())
+			Expect(headless.Spec.Ports).To(HaveLen(2))
+			Expect(headless.Spec.Ports[1].Name).To(Equal("metrics"))
+		})
+
+		// exporterはSASLとTLSを使わずに接続するため、spec.auth・spec.tlsとは併用できない
+		It("should be rejected together with auth or tls", func() {
+			for _, spec := range []cachev1alpha1.MemcachedSpec{
+				{Size: 1, Monitoring: cachev1alpha1.MonitoringSpec{Enabled: true}, Auth: &cachev1alpha1.AuthSpec{SecretName: memcachedName + "-auth"}},
+				{Size: 1, Monitoring: cachev1alpha1.MonitoringSpec{Enabled: true}, TLS: &cachev1alpha1.TLSSpec{SecretName: memcachedName + "-tls"}},
+			} {
+				memcached := &cachev1alpha1.Memcached{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					Spec: spec,
+				}
+				err := k8sClient.Create(ctx, memcached)
+				Expect(errors.IsInvalid(err)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring("monitoring can't be enabled with auth or tls"))
+			}
+		})
+	})
+
+	// spec.autoscalingの場合、HPAが作成され、HPAが変更したreplicasをspec.sizeで上書きしないことをテスト
+	Context("When Memcached is created with autoscaling and a PodDisruptionBudget", func() {
+		It("HorizontalPodAutoscaler and PodDisruptionBudget should be created and the replicas left to the HPA", func() {
+			minReplicas := int32(2)
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 1,
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+					},
+					Autoscaling: &cachev1alpha1.AutoscalingSpec{
+						MinReplicas: &minReplicas,
+						MaxReplicas: 4,
+					},
+					PodDisruptionBudget: &cachev1alpha1.PodDisruptionBudgetSpec{},
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+			Eventually(func() error {
+				return k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					hpa)
+			}, timeout, interval).Should(BeNil())
+			Expect(hpa.Spec.ScaleTargetRef.Kind).To(Equal("Deployment"))
+			Expect(*hpa.Spec.MinReplicas).To(Equal(int32(2)))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(4)))
+			Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(80)))
+
+			pdb := &policyv1.PodDisruptionBudget{}
+			Eventually(func() error {
+				return k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					pdb)
+			}, timeout, interval).Should(BeNil())
+			Expect(pdb.Spec.MaxUnavailable.IntValue()).To(Equal(1))
+
+			// spec.sizeはHPAのminReplicasに丸められる
+			deployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					deployment)
+			}, timeout, interval).Should(BeNil())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+
+			// HPAの代わりにDeploymentのreplicasを変更しても、Reconcileでspec.sizeに戻されない
+			replicas := int32(3)
+			deployment.Spec.Replicas = &replicas
+			err = k8sClient.Update(ctx, deployment)
+			Expect(err).NotTo(HaveOccurred())
+			Consistently(func() int32 {
+				err := k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					deployment)
+				Expect(err).NotTo(HaveOccurred())
+				return *deployment.Spec.Replicas
+			}, time.Second*2, interval).Should(Equal(int32(3)))
+		})
+	})
+
+	// HPAがスケールできない設定と、HPAに無視されるspec.sizeの変更が拒否されることをテスト
+	Context("When Memcached is autoscaled", func() {
+		It("should require a CPU request and reject changes of size", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size:        1,
+					Autoscaling: &cachev1alpha1.AutoscalingSpec{MaxReplicas: 4},
+				},
+			}
+			// CPU使用率でスケールするにはCPUのrequestが必要
+			err := k8sClient.Create(ctx, memcached)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("requires resources.requests.cpu"))
+
+			// カスタムメトリクスだけでスケールする場合は不要
+			memcached.Spec.Autoscaling.CustomMetric = &cachev1alpha1.CustomMetricTarget{
+				Name:         "memcached_current_connections",
+				AverageValue: resource.MustParse("100"),
+			}
+			err = k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			// scaleサブリソースと同様に、spec.sizeの変更は拒否される
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}, memcached)
+			Expect(err).NotTo(HaveOccurred())
+			memcached.Spec.Size = 3
+			err = k8sClient.Update(ctx, memcached)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("size can't be changed while autoscaling is set"))
+		})
+	})
+
+	// spec.spreadAcrossZonesなどのスケジューリングの設定がPodテンプレートに反映されることをテスト
+	Context("When Memcached is created with scheduling controls", func() {
+		It("Deployment's pod template should have the scheduling controls", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size:         2,
+					NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+					Tolerations: []corev1.Toleration{{
+						Key:      "dedicated",
+						Operator: corev1.TolerationOpEqual,
+						Value:    "cache",
+						Effect:   corev1.TaintEffectNoSchedule,
+					}},
+					SpreadAcrossZones: true,
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(
+					ctx,
+					types.NamespacedName{
+						Name:      memcachedName,
+						Namespace: memcachedNamespace,
+					},
+					deployment)
+			}, timeout, interval).Should(BeNil())
+			podSpec := deployment.Spec.Template.Spec
+			Expect(podSpec.NodeSelector).To(Equal(map[string]string{"kubernetes.io/os": "linux"}))
+			Expect(podSpec.Tolerations).To(HaveLen(1))
+			Expect(podSpec.TopologySpreadConstraints).To(HaveLen(1))
+			Expect(podSpec.TopologySpreadConstraints[0].TopologyKey).To(Equal("topology.kubernetes.io/zone"))
+			Expect(podSpec.TopologySpreadConstraints[0].WhenUnsatisfiable).To(Equal(corev1.ScheduleAnyway))
+			Expect(podSpec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution).To(HaveLen(1))
+			Expect(podSpec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].PodAffinityTerm.TopologyKey).To(Equal("kubernetes.io/hostname"))
+		})
+	})
+
+	// spec.tlsで参照しているSecretがない場合はDegradedになり、Secretが作成・変更されるとPodテンプレートが更新されることをテスト
+	Context("When Memcached is created with TLS", func() {
+		It("Deployment should be created after the Secret and rolled when the Secret changes", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 1,
+					TLS:  &cachev1alpha1.TLSSpec{SecretName: memcachedName + "-tls"},
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			key := types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}
+			Eventually(func() *metav1.Condition {
+				err := k8sClient.Get(ctx, key, memcached)
+				if err != nil {
+					return nil
+				}
+				return meta.FindStatusCondition(memcached.Status.Conditions, cachev1alpha1.ConditionDegraded)
+			}, timeout, interval).Should(HaveField("Reason", "SecretNotFound"))
+			deployment := &appsv1.Deployment{}
+			err = k8sClient.Get(ctx, key, deployment)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName + "-tls",
+					Namespace: memcachedNamespace,
+				},
+				Type: corev1.SecretTypeTLS,
+				Data: map[string][]byte{
+					corev1.TLSCertKey:       []byte("cert"),
+					corev1.TLSPrivateKeyKey: []byte("key"),
+				},
+			}
+			err = k8sClient.Create(ctx, secret)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, key, deployment)
+			}, timeout, interval).Should(BeNil())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Command).To(ContainElement("-Z"))
+			Expect(deployment.Spec.Template.Spec.Volumes).To(HaveLen(1))
+			hash := deployment.Spec.Template.Annotations["cache.example.com/secret-hash"]
+			Expect(hash).NotTo(BeEmpty())
+
+			// Secretを変更するとsecret-hashアノテーションが変わる
+			secret.Data[corev1.TLSCertKey] = []byte("new cert")
+			err = k8sClient.Update(ctx, secret)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() string {
+				err := k8sClient.Get(ctx, key, deployment)
+				if err != nil {
+					return ""
+				}
+				return deployment.Spec.Template.Annotations["cache.example.com/secret-hash"]
+			}, timeout, interval).ShouldNot(Equal(hash))
+		})
+	})
+
+	// spec.authで参照しているSecretがない・キーがない場合はDegradedになり、SASLのConfigMapがspec.authに合わせて作成・削除されることをテスト
+	Context("When Memcached is created with SASL authentication", func() {
+		It("Deployment should be created after a valid Secret and the SASL ConfigMap follow spec.auth", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 1,
+					Auth: &cachev1alpha1.AuthSpec{SecretName: memcachedName + "-auth"},
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			key := types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}
+			degradedReason := func() string {
+				if err := k8sClient.Get(ctx, key, memcached); err != nil {
+					return ""
+				}
+				condition := meta.FindStatusCondition(memcached.Status.Conditions, cachev1alpha1.ConditionDegraded)
+				if condition == nil || condition.Status != metav1.ConditionTrue {
+					return ""
+				}
+				return condition.Reason
+			}
+			Eventually(degradedReason, timeout, interval).Should(Equal("SecretNotFound"))
+
+			// memcached-sasl-pwdbキーがないSecretは不正
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName + "-auth",
+					Namespace: memcachedNamespace,
+				},
+				Data: map[string][]byte{"password": []byte("user:password")},
+			}
+			err = k8sClient.Create(ctx, secret)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(degradedReason, timeout, interval).Should(Equal("InvalidSecret"))
+			deployment := &appsv1.Deployment{}
+			err = k8sClient.Get(ctx, key, deployment)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+
+			secret.Data = map[string][]byte{"memcached-sasl-pwdb": []byte("user:password")}
+			err = k8sClient.Update(ctx, secret)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, key, deployment)
+			}, timeout, interval).Should(BeNil())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Command).To(ContainElement("-S"))
+			Expect(deployment.Spec.Template.Spec.Volumes).To(HaveLen(2))
+			Expect(deployment.Spec.Template.Annotations["cache.example.com/secret-hash"]).NotTo(BeEmpty())
+
+			configMapKey := types.NamespacedName{Name: memcachedName + "-sasl", Namespace: memcachedNamespace}
+			configMap := &corev1.ConfigMap{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, configMapKey, configMap)
+			}, timeout, interval).Should(BeNil())
+			Expect(metav1.IsControlledBy(configMap, memcached)).To(BeTrue())
+			Expect(configMap.Data["memcached.conf"]).To(ContainSubstring("mech_list: plain"))
+
+			// spec.authを外すとConfigMapが削除され、PodテンプレートからSASLの設定が外れる
+			err = k8sClient.Get(ctx, key, memcached)
+			Expect(err).NotTo(HaveOccurred())
+			memcached.Spec.Auth = nil
+			err = k8sClient.Update(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, configMapKey, configMap)
+				return errors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, key, deployment); err != nil {
+					return nil
+				}
+				return deployment.Spec.Template.Spec.Containers[0].Command
+			}, timeout, interval).ShouldNot(ContainElement("-S"))
+			Expect(deployment.Spec.Template.Spec.Volumes).To(BeEmpty())
+		})
+	})
+
+	// Memcachedを削除すると、Deploymentのreplicasを0にしてPodの終了を待ってからDeploymentを削除することをテスト
+	Context("When Memcached is deleted", func() {
+		It("Deployment should be scaled to zero and deleted after the pods terminate", func() {
+			memcached := &cachev1alpha1.Memcached{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: memcachedApiVersion,
+					Kind:       memcachedKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName,
+					Namespace: memcachedNamespace,
+				},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 2,
+				},
+			}
+			err := k8sClient.Create(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			key := types.NamespacedName{Name: memcachedName, Namespace: memcachedNamespace}
+			Eventually(func() []string {
+				err := k8sClient.Get(ctx, key, memcached)
+				if err != nil {
+					return nil
+				}
+				return memcached.Finalizers
+			}, timeout, interval).Should(ContainElement("cache.example.com/finalizer"))
+			deployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, key, deployment)
+			}, timeout, interval).Should(BeNil())
+
+			// envtestではDeploymentのコントローラーが動かないため、Podを作成してPodの終了を待つことを確認する
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      memcachedName + "-drain",
+					Namespace: memcachedNamespace,
+					Labels:    map[string]string{"app": "memcached", "memcached_cr": memcachedName},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "memcached", Image: "memcached:1.4.36-alpine"}},
+				},
+			}
+			err = k8sClient.Create(ctx, pod)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Delete(ctx, memcached)
+			Expect(err).NotTo(HaveOccurred())
+
+			// replicasが0になり、Podが残っている間はDeploymentとMemcachedは削除されない
+			Eventually(func() int32 {
+				err := k8sClient.Get(ctx, key, deployment)
+				if err != nil {
+					return -1
+				}
+				return *deployment.Spec.Replicas
+			}, timeout, interval).Should(Equal(int32(0)))
+			Consistently(func() error {
+				return k8sClient.Get(ctx, key, deployment)
+			}, time.Second*2, interval).Should(BeNil())
+			err = k8sClient.Get(ctx, key, memcached)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(memcached.DeletionTimestamp).NotTo(BeNil())
+
+			// Podが終了するとDeploymentが削除され、finalizerが外れてMemcachedが削除される
+			err = k8sClient.Delete(ctx, pod, client.GracePeriodSeconds(0))
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, key, deployment)
+				return errors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, key, memcached)
+				return errors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+
+			// Created, Scaled, DeletedのEventが記録される
+			Eventually(func() []string {
+				eventList := &corev1.EventList{}
+				err := k8sClient.List(ctx, eventList, client.InNamespace(memcachedNamespace))
+				if err != nil {
+					return nil
+				}
+				var reasons []string
+				for _, e := range eventList.Items {
+					if e.InvolvedObject.Kind == memcachedKind && e.InvolvedObject.Name == memcachedName && e.InvolvedObject.UID == memcached.UID {
+						reasons = append(reasons, e.Reason)
+					}
+				}
+				return reasons
+			}, timeout, interval).Should(ContainElements("Created", "Scaled", "Deleted"))
+		})
+	})
+
 	// It("Should be true", func() {
 	// 	Expect(true).To(BeTrue())
 	// })
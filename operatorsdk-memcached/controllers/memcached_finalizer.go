@@ -0,0 +1,149 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	cachev1alpha1 "github.com/example/operatorsdk-memcached/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// memcachedFinalizer drains the memcached pods before the workload is deleted
+const memcachedFinalizer = "cache.example.com/finalizer"
+
+// Reasons of the events recorded on a Memcached
+const (
+	eventCreated = "Created"
+	eventScaled  = "Scaled"
+	eventDeleted = "Deleted"
+)
+
+// finalizeMemcached drains the memcached pods of a Memcached being deleted and then deletes its workloads.
+// The workloads are scaled to zero first, and deleted once all the memcached pods have terminated.
+// The finalizer is removed when the workloads are gone.
+func (r *MemcachedReconciler) finalizeMemcached(ctx context.Context, m *cachev1alpha1.Memcached) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	if !controllerutil.ContainsFinalizer(m, memcachedFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	key := types.NamespacedName{Name: m.Name, Namespace: m.Namespace}
+
+	// HPAがreplicasを戻さないように、先にHPAを削除する
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+	err := r.Get(ctx, key, hpa)
+	if err == nil && metav1.IsControlledBy(hpa, m) {
+		if err := r.Delete(ctx, hpa); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+	} else if client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Memcachedが所有しているワークロードのreplicasを0にする
+	var workloads []client.Object
+	for _, workload := range []client.Object{&appsv1.Deployment{}, &appsv1.StatefulSet{}} {
+		err := r.Get(ctx, key, workload)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !metav1.IsControlledBy(workload, m) {
+			continue
+		}
+		workloads = append(workloads, workload)
+		if !scaleToZero(workload) {
+			continue
+		}
+		logger.Info("Scaling the workload to zero before deletion", "workload", client.ObjectKeyFromObject(workload))
+		if err := r.Update(ctx, workload); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, eventScaled, "Scaled %s %s to 0 before deletion", workloadKind(workload), workload.GetName())
+	}
+
+	// 全てのPodが終了するまで待つ（Podの削除の監視で再度Reconcileされる）
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(m.Namespace), client.MatchingLabels(labelsForMemcached(m.Name))); err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(podList.Items) > 0 {
+		logger.Info("Waiting for the memcached pods to terminate", "pods", len(podList.Items))
+		return ctrl.Result{}, nil
+	}
+
+	for _, workload := range workloads {
+		logger.Info("Deleting the workload", "workload", client.ObjectKeyFromObject(workload))
+		if err := r.Delete(ctx, workload); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, eventDeleted, "Deleted %s %s", workloadKind(workload), workload.GetName())
+	}
+
+	controllerutil.RemoveFinalizer(m, memcachedFinalizer)
+	if err := r.Update(ctx, m); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// scaleToZero sets the replicas of the workload to 0, and reports whether they were changed
+func scaleToZero(workload client.Object) bool {
+	var replicas **int32
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		replicas = &w.Spec.Replicas
+	case *appsv1.StatefulSet:
+		replicas = &w.Spec.Replicas
+	default:
+		return false
+	}
+	if *replicas != nil && **replicas == 0 {
+		return false
+	}
+	zero := int32(0)
+	*replicas = &zero
+	return true
+}
+
+// workloadKind returns the kind of a Deployment or StatefulSet for the messages of the events
+func workloadKind(workload client.Object) string {
+	if _, ok := workload.(*appsv1.StatefulSet); ok {
+		return string(cachev1alpha1.WorkloadTypeStatefulSet)
+	}
+	return string(cachev1alpha1.WorkloadTypeDeployment)
+}
+
+// recordScaled records a Scaled event if the replicas of the workload were changed from the previous replicas
+func (r *MemcachedReconciler) recordScaled(m *cachev1alpha1.Memcached, workload client.Object, previous, replicas *int32) {
+	if previous == nil || replicas == nil || *previous == *replicas {
+		return
+	}
+	r.Recorder.Event(m, corev1.EventTypeNormal, eventScaled,
+		fmt.Sprintf("Scaled %s %s from %d to %d", workloadKind(workload), workload.GetName(), *previous, *replicas))
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	cachev1alpha1 "github.com/example/operatorsdk-memcached/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// defaultExporterImage is used when spec.monitoring.exporterImage is omitted (same as the CRD default)
+	defaultExporterImage = "prom/memcached-exporter:v0.13.0"
+	metricsPort          = 9150
+)
+
+// serviceMonitorGVK is the ServiceMonitor kind of the Prometheus Operator.
+// The Prometheus Operator is not a dependency of this module, so ServiceMonitors are handled as unstructured objects.
+var serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+
+// ServiceMonitorAvailable reports whether the ServiceMonitor CRD is installed in the cluster
+func ServiceMonitorAvailable(client discovery.DiscoveryInterface) (bool, error) {
+	resources, err := client.ServerResourcesForGroupVersion(serviceMonitorGVK.GroupVersion().String())
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Kind == serviceMonitorGVK.Kind {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newServiceMonitor returns an empty ServiceMonitor object
+func newServiceMonitor() *unstructured.Unstructured {
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	return sm
+}
+
+// exporterContainer returns the memcached-exporter sidecar container
+func exporterContainer(m *cachev1alpha1.Memcached) corev1.Container {
+	image := m.Spec.Monitoring.ExporterImage
+	if image == "" {
+		image = defaultExporterImage
+	}
+	return corev1.Container{
+		Image: image,
+		Name:  "exporter",
+		Args:  []string{fmt.Sprintf("--memcached.address=localhost:%d", memcachedPort)},
+		Ports: []corev1.ContainerPort{{
+			ContainerPort: metricsPort,
+			Name:          "metrics",
+		}},
+	}
+}
+
+// reconcileServiceMonitor ensures the ServiceMonitor is the same as spec.monitoring.
+// It does nothing if the ServiceMonitor CRD is not installed.
+// It returns a *conflictError if the ServiceMonitor exists and is not controlled by m.
+func (r *MemcachedReconciler) reconcileServiceMonitor(ctx context.Context, m *cachev1alpha1.Memcached) error {
+	logger := log.FromContext(ctx)
+	if !r.ServiceMonitorAvailable {
+		if m.Spec.Monitoring.Enabled {
+			logger.Info("The ServiceMonitor CRD is not installed. Skipping the ServiceMonitor")
+		}
+		return nil
+	}
+
+	found := newServiceMonitor()
+	err := r.Get(ctx, client.ObjectKey{Name: m.Name, Namespace: m.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if !m.Spec.Monitoring.Enabled {
+		// spec.monitoring.enabledが無効になった場合は、Memcachedが所有しているServiceMonitorだけを削除
+		if !exists || !metav1.IsControlledBy(found, m) {
+			return nil
+		}
+		logger.Info("Deleting ServiceMonitor", "ServiceMonitor.Namespace", found.GetNamespace(), "ServiceMonitor.Name", found.GetName())
+		return client.IgnoreNotFound(r.Delete(ctx, found))
+	}
+
+	desired, err := r.serviceMonitorForMemcached(m)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		logger.Info("Creating a new ServiceMonitor", "ServiceMonitor.Namespace", desired.GetNamespace(), "ServiceMonitor.Name", desired.GetName())
+		return r.Create(ctx, desired)
+	}
+	// 所有していないServiceMonitorは上書きしない
+	if !metav1.IsControlledBy(found, m) {
+		return &conflictError{kind: "ServiceMonitor", name: found.GetName()}
+	}
+	if reflect.DeepEqual(found.Object["spec"], desired.Object["spec"]) {
+		return nil
+	}
+	found.Object["spec"] = desired.Object["spec"]
+	logger.Info("Updating ServiceMonitor", "ServiceMonitor.Namespace", found.GetNamespace(), "ServiceMonitor.Name", found.GetName())
+	return r.Update(ctx, found)
+}
+
+// serviceMonitorForMemcached returns a ServiceMonitor scraping the metrics port of the headless Service
+func (r *MemcachedReconciler) serviceMonitorForMemcached(m *cachev1alpha1.Memcached) (*unstructured.Unstructured, error) {
+	endpoint := map[string]interface{}{"port": "metrics"}
+	if m.Spec.Monitoring.Interval != "" {
+		endpoint["interval"] = m.Spec.Monitoring.Interval
+	}
+	matchLabels := map[string]interface{}{}
+	for k, v := range labelsForMemcached(m.Name) {
+		matchLabels[k] = v
+	}
+
+	sm := newServiceMonitor()
+	sm.SetName(m.Name)
+	sm.SetNamespace(m.Namespace)
+	sm.SetLabels(labelsForMemcached(m.Name))
+	sm.Object["spec"] = map[string]interface{}{
+		"selector":  map[string]interface{}{"matchLabels": matchLabels},
+		"endpoints": []interface{}{endpoint},
+	}
+	// Set Memcached instance as the owner and controller
+	if err := ctrl.SetControllerReference(m, sm, r.Scheme); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
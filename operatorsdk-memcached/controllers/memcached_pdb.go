@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	cachev1alpha1 "github.com/example/operatorsdk-memcached/api/v1alpha1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reconcilePodDisruptionBudget ensures the PodDisruptionBudget is the same as spec.podDisruptionBudget.
+// It returns a *conflictError if the PodDisruptionBudget exists and is not controlled by m.
+func (r *MemcachedReconciler) reconcilePodDisruptionBudget(ctx context.Context, m *cachev1alpha1.Memcached) error {
+	logger := log.FromContext(ctx)
+
+	found := &policyv1.PodDisruptionBudget{}
+	err := r.Get(ctx, types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if m.Spec.PodDisruptionBudget == nil {
+		// spec.podDisruptionBudgetが外された場合は、Memcachedが所有しているPodDisruptionBudgetだけを削除する
+		if !exists || !metav1.IsControlledBy(found, m) {
+			return nil
+		}
+		logger.Info("Deleting PodDisruptionBudget", "PodDisruptionBudget.Namespace", found.Namespace, "PodDisruptionBudget.Name", found.Name)
+		return client.IgnoreNotFound(r.Delete(ctx, found))
+	}
+
+	desired := r.podDisruptionBudgetForMemcached(m)
+	if !exists {
+		logger.Info("Creating a new PodDisruptionBudget", "PodDisruptionBudget.Namespace", desired.Namespace, "PodDisruptionBudget.Name", desired.Name)
+		return r.Create(ctx, desired)
+	}
+	// 所有していないPodDisruptionBudgetは上書きしない
+	if !metav1.IsControlledBy(found, m) {
+		return &conflictError{kind: "PodDisruptionBudget", name: found.Name}
+	}
+	if equality.Semantic.DeepEqual(found.Spec, desired.Spec) {
+		return nil
+	}
+	found.Spec = desired.Spec
+	logger.Info("Updating PodDisruptionBudget", "PodDisruptionBudget.Namespace", found.Namespace, "PodDisruptionBudget.Name", found.Name)
+	return r.Update(ctx, found)
+}
+
+// podDisruptionBudgetForMemcached returns a PodDisruptionBudget of the memcached pods.
+// Only one of minAvailable and maxUnavailable is set, preferring minAvailable.
+func (r *MemcachedReconciler) podDisruptionBudgetForMemcached(m *cachev1alpha1.Memcached) *policyv1.PodDisruptionBudget {
+	spec := policyv1.PodDisruptionBudgetSpec{
+		Selector: &metav1.LabelSelector{
+			MatchLabels: labelsForMemcached(m.Name),
+		},
+	}
+	switch pdb := m.Spec.PodDisruptionBudget; {
+	case pdb.MinAvailable != nil:
+		minAvailable := *pdb.MinAvailable
+		spec.MinAvailable = &minAvailable
+	case pdb.MaxUnavailable != nil:
+		maxUnavailable := *pdb.MaxUnavailable
+		spec.MaxUnavailable = &maxUnavailable
+	default:
+		maxUnavailable := intstr.FromInt(1)
+		spec.MaxUnavailable = &maxUnavailable
+	}
+
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+			Labels:    labelsForMemcached(m.Name),
+		},
+		Spec: spec,
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, pdb, r.Scheme)
+	return pdb
+}
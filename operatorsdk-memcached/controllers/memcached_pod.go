@@ -0,0 +1,74 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// memcachedCRLabel is the label of the memcached pods holding the name of their Memcached
+const memcachedCRLabel = "memcached_cr"
+
+// memcachedForPod maps a memcached pod to the Memcached owning it via the memcached_cr label
+func (r *MemcachedReconciler) memcachedForPod(obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[memcachedCRLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
+
+// podPredicate filters the events of the pods that can't change the status of a Memcached:
+// pods without the memcached_cr label and updates that don't change the readiness,
+// the address or the failure of a pod.
+func podPredicate() predicate.Predicate {
+	return predicate.And(
+		predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			_, ok := obj.GetLabels()[memcachedCRLabel]
+			return ok
+		}),
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				oldPod, ok := e.ObjectOld.(*corev1.Pod)
+				if !ok {
+					return false
+				}
+				newPod, ok := e.ObjectNew.(*corev1.Pod)
+				if !ok {
+					return false
+				}
+				return podStateChanged(oldPod, newPod)
+			},
+			GenericFunc: func(event.GenericEvent) bool { return false },
+		},
+	)
+}
+
+// podStateChanged reports whether a change of the pod affects status.nodes, status.endpoints or the conditions
+func podStateChanged(oldPod, newPod *corev1.Pod) bool {
+	return isPodReady(oldPod) != isPodReady(newPod) ||
+		oldPod.Status.PodIP != newPod.Status.PodIP ||
+		podFailure(oldPod) != podFailure(newPod) ||
+		!reflect.DeepEqual(oldPod.Labels, newPod.Labels)
+}
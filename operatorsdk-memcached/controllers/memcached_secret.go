@@ -0,0 +1,246 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	cachev1alpha1 "github.com/example/operatorsdk-memcached/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// secretHashAnnotation is the pod template annotation holding the hash of the referenced Secrets.
+	// Secretが変更されるとPodテンプレートが変わり、Podがロールアウトされる
+	secretHashAnnotation = "cache.example.com/secret-hash"
+
+	// saslPasswordKey is the key of the SASL credentials in the spec.auth Secret
+	saslPasswordKey = "memcached-sasl-pwdb"
+	saslConfigKey   = "memcached.conf"
+	saslConfigPath  = "/etc/sasl2"
+	saslSecretPath  = "/etc/memcached/sasl"
+	tlsSecretPath   = "/etc/memcached/tls"
+
+	reasonSecretNotFound = "SecretNotFound"
+	reasonInvalidSecret  = "InvalidSecret"
+)
+
+// secretError is returned by secretHash when a referenced Secret is missing or invalid
+type secretError struct {
+	reason  string
+	message string
+}
+
+func (e *secretError) Error() string {
+	return e.message
+}
+
+// saslConfigMapName returns the name of the ConfigMap holding the SASL config of a Memcached
+func saslConfigMapName(name string) string {
+	return name + "-sasl"
+}
+
+// secretHash validates the Secrets referenced by spec.auth and spec.tls and returns a hash of their versions.
+// The hash is written to the pod template, which is readable by more users than the Secrets,
+// so it is computed from their UIDs and resourceVersions instead of their data.
+// It returns "" if no Secret is referenced, and a *secretError if a Secret is missing or lacks a key.
+func (r *MemcachedReconciler) secretHash(ctx context.Context, m *cachev1alpha1.Memcached) (string, error) {
+	type ref struct {
+		name string
+		keys []string
+	}
+	var refs []ref
+	if m.Spec.Auth != nil {
+		refs = append(refs, ref{name: m.Spec.Auth.SecretName, keys: []string{saslPasswordKey}})
+	}
+	if m.Spec.TLS != nil {
+		refs = append(refs, ref{name: m.Spec.TLS.SecretName, keys: []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey}})
+	}
+	if len(refs) == 0 {
+		return "", nil
+	}
+
+	h := sha256.New()
+	for _, ref := range refs {
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Name: ref.name, Namespace: m.Namespace}, secret)
+		if errors.IsNotFound(err) {
+			return "", &secretError{reason: reasonSecretNotFound, message: fmt.Sprintf("secret %q not found", ref.name)}
+		} else if err != nil {
+			return "", err
+		}
+		for _, key := range ref.keys {
+			if len(secret.Data[key]) == 0 {
+				return "", &secretError{reason: reasonInvalidSecret, message: fmt.Sprintf("secret %q has no %q key", ref.name, key)}
+			}
+		}
+		// Secretの値はハッシュに含めず、Secretが作り直される・更新されると変わるUIDとresourceVersionを使う
+		fmt.Fprintf(h, "%s/%s/%s:", ref.name, secret.UID, secret.ResourceVersion)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// reconcileSASLConfigMap ensures the ConfigMap holding the SASL config exists while spec.auth is set.
+// It returns a *conflictError if the ConfigMap exists and is not controlled by m.
+func (r *MemcachedReconciler) reconcileSASLConfigMap(ctx context.Context, m *cachev1alpha1.Memcached) error {
+	logger := log.FromContext(ctx)
+
+	found := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: saslConfigMapName(m.Name), Namespace: m.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if m.Spec.Auth == nil {
+		// spec.authが外された場合は、Memcachedが所有しているConfigMapだけを削除する
+		if !exists || !metav1.IsControlledBy(found, m) {
+			return nil
+		}
+		logger.Info("Deleting SASL ConfigMap", "ConfigMap.Namespace", found.Namespace, "ConfigMap.Name", found.Name)
+		return client.IgnoreNotFound(r.Delete(ctx, found))
+	}
+
+	desired := r.saslConfigMapForMemcached(m)
+	if !exists {
+		logger.Info("Creating a new SASL ConfigMap", "ConfigMap.Namespace", desired.Namespace, "ConfigMap.Name", desired.Name)
+		return r.Create(ctx, desired)
+	}
+	// 同名の他のMemcachedのConfigMapなど、所有していないConfigMapは上書きしない
+	if !metav1.IsControlledBy(found, m) {
+		return &conflictError{kind: "ConfigMap", name: found.Name}
+	}
+	if reflect.DeepEqual(found.Data, desired.Data) {
+		return nil
+	}
+	found.Data = desired.Data
+	logger.Info("Updating SASL ConfigMap", "ConfigMap.Namespace", found.Namespace, "ConfigMap.Name", found.Name)
+	return r.Update(ctx, found)
+}
+
+// saslConfigMapForMemcached returns the ConfigMap holding the SASL config of memcached.
+// Only the PLAIN mechanism is enabled, checking the passwords of the spec.auth Secret.
+func (r *MemcachedReconciler) saslConfigMapForMemcached(m *cachev1alpha1.Memcached) *corev1.ConfigMap {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      saslConfigMapName(m.Name),
+			Namespace: m.Namespace,
+			Labels:    labelsForMemcached(m.Name),
+		},
+		Data: map[string]string{
+			saslConfigKey: fmt.Sprintf("mech_list: plain\nsasldb_path: %s/%s\n", saslSecretPath, saslPasswordKey),
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, cm, r.Scheme)
+	return cm
+}
+
+// configureSecurity mounts the SASL config and credentials and the TLS certificate into the memcached container
+// of the pod template, and records the hash of the Secrets in the pod template
+func configureSecurity(template *corev1.PodTemplateSpec, m *cachev1alpha1.Memcached, secretHash string) {
+	if secretHash != "" {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[secretHashAnnotation] = secretHash
+	}
+	container := &template.Spec.Containers[0]
+	if m.Spec.Auth != nil {
+		template.Spec.Volumes = append(template.Spec.Volumes,
+			corev1.Volume{
+				Name: "sasl-config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: saslConfigMapName(m.Name)},
+					},
+				},
+			},
+			corev1.Volume{
+				Name: "sasl-credentials",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: m.Spec.Auth.SecretName,
+						Items:      []corev1.KeyToPath{{Key: saslPasswordKey, Path: saslPasswordKey}},
+					},
+				},
+			},
+		)
+		container.VolumeMounts = append(container.VolumeMounts,
+			corev1.VolumeMount{Name: "sasl-config", MountPath: saslConfigPath, ReadOnly: true},
+			corev1.VolumeMount{Name: "sasl-credentials", MountPath: saslSecretPath, ReadOnly: true},
+		)
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "SASL_CONF_PATH", Value: saslConfigPath},
+			corev1.EnvVar{Name: "MEMCACHED_SASL_PWDB", Value: saslSecretPath + "/" + saslPasswordKey},
+		)
+	}
+	if m.Spec.TLS != nil {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: "tls",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: m.Spec.TLS.SecretName,
+					Items: []corev1.KeyToPath{
+						{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+						{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+					},
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "tls", MountPath: tlsSecretPath, ReadOnly: true})
+	}
+}
+
+// securityArgs returns the memcached flags enabling SASL and TLS
+func securityArgs(m *cachev1alpha1.Memcached) []string {
+	var args []string
+	if m.Spec.Auth != nil {
+		args = append(args, "-S")
+	}
+	if m.Spec.TLS != nil {
+		args = append(args, "-Z", "-o", fmt.Sprintf("ssl_chain_cert=%s/%s,ssl_key=%s/%s", tlsSecretPath, corev1.TLSCertKey, tlsSecretPath, corev1.TLSPrivateKeyKey))
+	}
+	return args
+}
+
+// memcachedsForSecret maps a Secret to the Memcacheds in its namespace referencing it in spec.auth or spec.tls
+func (r *MemcachedReconciler) memcachedsForSecret(obj client.Object) []reconcile.Request {
+	memcachedList := &cachev1alpha1.MemcachedList{}
+	if err := r.List(context.Background(), memcachedList, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, m := range memcachedList.Items {
+		if (m.Spec.Auth != nil && m.Spec.Auth.SecretName == obj.GetName()) ||
+			(m.Spec.TLS != nil && m.Spec.TLS.SecretName == obj.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: m.Namespace, Name: m.Name}})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	cachev1alpha1 "github.com/example/operatorsdk-memcached/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reasonResourceConflict is the reason of the Degraded condition when an object already exists and is not owned by the Memcached
+const reasonResourceConflict = "ResourceConflict"
+
+// conflictRequeueAfter is how long to wait before checking a conflicting object again
+const conflictRequeueAfter = time.Minute
+
+// conflictError is returned when an object the Memcached manages already exists and is not controlled by it,
+// e.g. the ClusterIP Service of a Memcached named "<name>-headless". The object is never updated.
+type conflictError struct {
+	kind string
+	name string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("%s %q already exists and is not owned by the Memcached", e.kind, e.name)
+}
+
+// reportConflict records cerr in the Degraded condition of m and requeues the Memcached,
+// since removing the conflicting object does not trigger a reconcile.
+func (r *MemcachedReconciler) reportConflict(ctx context.Context, m *cachev1alpha1.Memcached, cerr *conflictError) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("Object is not owned by the Memcached", "kind", cerr.kind, "name", cerr.name)
+	original := m.Status.DeepCopy()
+	setCondition(m, cachev1alpha1.ConditionDegraded, metav1.ConditionTrue, reasonResourceConflict, cerr.Error())
+	if !reflect.DeepEqual(original, &m.Status) {
+		if err := r.Status().Update(ctx, m); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: conflictRequeueAfter}, nil
+}
+
+// headlessServiceName returns the name of the headless Service of the given memcached CR name
+func headlessServiceName(name string) string {
+	return name + "-headless"
+}
+
+// reconcileServices ensures the headless Service and, if enabled, the ClusterIP Service
+// are the same as the spec. The ClusterIP Service is deleted when it is disabled.
+func (r *MemcachedReconciler) reconcileServices(ctx context.Context, m *cachev1alpha1.Memcached) error {
+	if err := r.reconcileService(ctx, m, r.serviceForMemcached(m, headlessServiceName(m.Name), true)); err != nil {
+		return err
+	}
+
+	clusterIP := r.serviceForMemcached(m, m.Name, false)
+	if m.Spec.Service.ClusterIP {
+		return r.reconcileService(ctx, m, clusterIP)
+	}
+	// spec.service.clusterIPが無効になった場合は、Memcachedが所有しているServiceだけを削除
+	found := &corev1.Service{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(clusterIP), found)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(found, m) {
+		return nil
+	}
+	log.FromContext(ctx).Info("Deleting ClusterIP Service", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+	return client.IgnoreNotFound(r.Delete(ctx, found))
+}
+
+// reconcileService creates the desired Service if it does not exist, or updates its ports and selector.
+// It returns a *conflictError if the Service exists and is not controlled by m.
+func (r *MemcachedReconciler) reconcileService(ctx context.Context, m *cachev1alpha1.Memcached, desired *corev1.Service) error {
+	logger := log.FromContext(ctx)
+
+	found := &corev1.Service{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(desired), found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new Service", "Service.Namespace", desired.Namespace, "Service.Name", desired.Name)
+		return r.Create(ctx, desired)
+	} else if err != nil {
+		return err
+	}
+	// 同名の他のMemcachedのServiceなど、所有していないServiceは上書きしない
+	if !metav1.IsControlledBy(found, m) {
+		return &conflictError{kind: "Service", name: found.Name}
+	}
+
+	// clusterIPなどAPIサーバーが割り当てたフィールドは残し、ポートとセレクタだけを更新する
+	if reflect.DeepEqual(found.Spec.Ports, desired.Spec.Ports) && reflect.DeepEqual(found.Spec.Selector, desired.Spec.Selector) {
+		return nil
+	}
+	found.Spec.Ports = desired.Spec.Ports
+	found.Spec.Selector = desired.Spec.Selector
+	logger.Info("Updating Service", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+	return r.Update(ctx, found)
+}
+
+// serviceForMemcached returns a memcached Service object.
+// The headless Service lets clients discover the addresses of every pod.
+func (r *MemcachedReconciler) serviceForMemcached(m *cachev1alpha1.Memcached, name string, headless bool) *corev1.Service {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: m.Namespace,
+			Labels:    labelsForMemcached(m.Name),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labelsForMemcached(m.Name),
+			Ports: []corev1.ServicePort{{
+				Name:       "memcached",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       memcachedPort,
+				TargetPort: intstr.FromString("memcached"),
+			}},
+		},
+	}
+	if headless {
+		svc.Spec.ClusterIP = corev1.ClusterIPNone
+		// ServiceMonitorが同じPodを重複して監視しないように、metricsポートはheadless Serviceにだけ追加する
+		if m.Spec.Monitoring.Enabled {
+			svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+				Name:       "metrics",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       metricsPort,
+				TargetPort: intstr.FromString("metrics"),
+			})
+		}
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, svc, r.Scheme)
+	return svc
+}
+
+// getEndpoints returns the sorted "host:port" addresses of the ready pods passed in
+func getEndpoints(pods []corev1.Pod) []string {
+	var endpoints []string
+	for _, pod := range pods {
+		if !isPodReady(&pod) {
+			continue
+		}
+		// StatefulSetのPodはheadless ServiceでDNS名が解決できるため、再作成されても変わらないDNS名を使う
+		host := pod.Status.PodIP
+		if pod.Spec.Hostname != "" && pod.Spec.Subdomain != "" {
+			host = fmt.Sprintf("%s.%s.%s.svc", pod.Spec.Hostname, pod.Spec.Subdomain, pod.Namespace)
+		}
+		if host == "" {
+			continue
+		}
+		endpoints = append(endpoints, net.JoinHostPort(host, strconv.Itoa(memcachedPort)))
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// isPodReady reports whether the pod is running, not being deleted and has the Ready condition
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
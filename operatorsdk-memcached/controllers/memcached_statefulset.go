@@ -0,0 +1,161 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	cachev1alpha1 "github.com/example/operatorsdk-memcached/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reconcileStatefulSet creates the StatefulSet if it does not exist, or updates it to match the spec.
+// It reports whether the StatefulSet was changed.
+func (r *MemcachedReconciler) reconcileStatefulSet(ctx context.Context, memcached *cachev1alpha1.Memcached, secretHash string) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	// 3. Check if the statefulset already exists, if not create a new one
+	found := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		sts := r.statefulSetForMemcached(memcached, secretHash)
+		logger.Info("3. Check if the statefulset already exists, if not create a new one. Creating a new StatefulSet", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+		err = r.Create(ctx, sts)
+		if err != nil {
+			logger.Error(err, "3. Check if the statefulset already exists, if not create a new one. Failed to create new StatefulSet", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+			return false, err
+		}
+		r.Recorder.Eventf(memcached, corev1.EventTypeNormal, eventCreated, "Created StatefulSet %s", sts.Name)
+		return true, nil
+	} else if err != nil {
+		logger.Error(err, "3. Check if the statefulset already exists, if not create a new one. Failed to get StatefulSet")
+		return false, err
+	}
+
+	// 4. Ensure the statefulset is the same as the spec
+	desired := r.statefulSetForMemcached(memcached, secretHash)
+	if memcached.Spec.Autoscaling != nil {
+		// HPAと取り合いにならないように、spec.autoscalingがある場合はreplicasを変更しない
+		desired.Spec.Replicas = found.Spec.Replicas
+	}
+	previous := found.Spec.Replicas
+	if updateStatefulSet(found, desired) {
+		err = r.Update(ctx, found)
+		if err != nil {
+			logger.Error(err, "4. Ensure the statefulset is the same as the spec. Failed to update StatefulSet", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+			return false, err
+		}
+		r.recordScaled(memcached, found, previous, found.Spec.Replicas)
+		logger.Info("4. Ensure the statefulset is the same as the spec. Update statefulset", "StatefulSet.Spec.Replicas", *found.Spec.Replicas, "templateHash", found.Annotations[templateHashAnnotation])
+		return true, nil
+	}
+	return false, nil
+}
+
+// statefulSetForMemcached returns a memcached StatefulSet object.
+// The pods are named "<name>-<ordinal>" and resolvable in the headless Service.
+func (r *MemcachedReconciler) statefulSetForMemcached(m *cachev1alpha1.Memcached, secretHash string) *appsv1.StatefulSet {
+	replicas := replicasForMemcached(m)
+	template := podTemplateForMemcached(m, secretHash)
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        m.Name,
+			Namespace:   m.Namespace,
+			Annotations: map[string]string{templateHashAnnotation: templateHash(&template)},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labelsForMemcached(m.Name),
+			},
+			ServiceName: headlessServiceName(m.Name),
+			// memcachedのPod間に起動順序の依存はないため、並列に作成・削除する
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Template:            template,
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, sts, r.Scheme)
+	return sts
+}
+
+// updateStatefulSet copies the replicas and the pod template of desired to found
+// if they differ, and reports whether found was changed.
+// The selector and the serviceName of a StatefulSet are immutable and never change.
+func updateStatefulSet(found, desired *appsv1.StatefulSet) bool {
+	changed := false
+	if found.Spec.Replicas == nil || *found.Spec.Replicas != *desired.Spec.Replicas {
+		found.Spec.Replicas = desired.Spec.Replicas
+		changed = true
+	}
+	hash := desired.Annotations[templateHashAnnotation]
+	if found.Annotations[templateHashAnnotation] != hash {
+		found.Spec.Template = desired.Spec.Template
+		if found.Annotations == nil {
+			found.Annotations = map[string]string{}
+		}
+		found.Annotations[templateHashAnnotation] = hash
+		changed = true
+	}
+	return changed
+}
+
+// removePreviousWorkload deletes the workload of the other workloadType after spec.workloadType
+// was changed, once every replica of the current workload is ready.
+func (r *MemcachedReconciler) removePreviousWorkload(ctx context.Context, m *cachev1alpha1.Memcached) error {
+	logger := log.FromContext(ctx)
+	key := types.NamespacedName{Name: m.Name, Namespace: m.Namespace}
+
+	current, err := r.getWorkloadStatus(ctx, m)
+	if err != nil {
+		return err
+	}
+	var previous client.Object = &appsv1.Deployment{}
+	if m.Spec.WorkloadType != cachev1alpha1.WorkloadTypeStatefulSet {
+		previous = &appsv1.StatefulSet{}
+	}
+
+	err = r.Get(ctx, key, previous)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// Memcachedが所有していないワークロードは削除しない
+	if !metav1.IsControlledBy(previous, m) {
+		return nil
+	}
+	if !current.ready() {
+		// 新しいワークロードのstatusが変わると再度Reconcileされる
+		logger.Info("Waiting for the new workload to become ready before removing the previous one", "workload", client.ObjectKeyFromObject(current.object))
+		return nil
+	}
+	logger.Info("Removing the previous workload", "workload", client.ObjectKeyFromObject(previous))
+	if err := r.Delete(ctx, previous); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.Recorder.Eventf(m, corev1.EventTypeNormal, eventDeleted, "Deleted %s %s after migrating to %s", workloadKind(previous), previous.GetName(), m.Spec.WorkloadType)
+	return nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cachev1alpha1 "github.com/example/operatorsdk-memcached/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reasons of the Available, Progressing and Degraded conditions
+const (
+	reasonReplicasAvailable   = "MinimumReplicasAvailable"
+	reasonNoReplicasAvailable = "NoReplicasAvailable"
+	reasonScaledToZero        = "ScaledToZero"
+	reasonRollingOut          = "RollingOut"
+	reasonRolloutComplete     = "RolloutComplete"
+	reasonPodsFailing         = "PodsFailing"
+	reasonAsExpected          = "AsExpected"
+)
+
+// workloadStatus is the rollout state of the Deployment or StatefulSet of a Memcached
+type workloadStatus struct {
+	object          client.Object
+	replicas        int32
+	updatedReplicas int32
+	readyReplicas   int32
+	// observed reports whether the workload controller has processed the latest spec of the workload
+	observed bool
+}
+
+// ready reports whether every replica of the workload is ready
+func (s *workloadStatus) ready() bool {
+	return s.observed && s.readyReplicas >= s.replicas
+}
+
+// rolledOut reports whether every replica of the workload runs the latest pod template and is ready
+func (s *workloadStatus) rolledOut() bool {
+	return s.ready() && s.updatedReplicas >= s.replicas
+}
+
+// getWorkloadStatus returns the state of the workload of the current spec.workloadType
+func (r *MemcachedReconciler) getWorkloadStatus(ctx context.Context, m *cachev1alpha1.Memcached) (*workloadStatus, error) {
+	key := types.NamespacedName{Name: m.Name, Namespace: m.Namespace}
+	if m.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+		sts := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, key, sts); err != nil {
+			return nil, err
+		}
+		return &workloadStatus{
+			object:          sts,
+			replicas:        *sts.Spec.Replicas,
+			updatedReplicas: sts.Status.UpdatedReplicas,
+			readyReplicas:   sts.Status.ReadyReplicas,
+			observed:        sts.Status.ObservedGeneration >= sts.Generation,
+		}, nil
+	}
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err != nil {
+		return nil, err
+	}
+	return &workloadStatus{
+		object:          dep,
+		replicas:        *dep.Spec.Replicas,
+		updatedReplicas: dep.Status.UpdatedReplicas,
+		readyReplicas:   dep.Status.ReadyReplicas,
+		observed:        dep.Status.ObservedGeneration >= dep.Generation,
+	}, nil
+}
+
+// setStatus updates the status of the Memcached from the state of its workload and pods
+func setStatus(m *cachev1alpha1.Memcached, workload *workloadStatus, pods []corev1.Pod) {
+	m.Status.Nodes = getPodNames(pods)
+	m.Status.Endpoints = getEndpoints(pods)
+	m.Status.ReadyReplicas = int32(len(m.Status.Nodes))
+	// scaleサブリソースのstatus.replicasとselector。HPAがある場合はspec.sizeではなくワークロードのreplicasになる
+	m.Status.Replicas = workload.replicas
+	m.Status.Selector = labels.SelectorFromSet(labelsForMemcached(m.Name)).String()
+	m.Status.ObservedGeneration = m.Generation
+
+	switch {
+	case workload.replicas == 0:
+		setCondition(m, cachev1alpha1.ConditionAvailable, metav1.ConditionFalse, reasonScaledToZero, "size is 0")
+	case m.Status.ReadyReplicas > 0:
+		setCondition(m, cachev1alpha1.ConditionAvailable, metav1.ConditionTrue, reasonReplicasAvailable,
+			fmt.Sprintf("%d of %d pods are ready", m.Status.ReadyReplicas, workload.replicas))
+	default:
+		setCondition(m, cachev1alpha1.ConditionAvailable, metav1.ConditionFalse, reasonNoReplicasAvailable, "no pods are ready")
+	}
+
+	if workload.rolledOut() {
+		setCondition(m, cachev1alpha1.ConditionProgressing, metav1.ConditionFalse, reasonRolloutComplete, "all pods are up to date and ready")
+	} else {
+		setCondition(m, cachev1alpha1.ConditionProgressing, metav1.ConditionTrue, reasonRollingOut,
+			fmt.Sprintf("%d of %d pods are up to date, %d are ready", workload.updatedReplicas, workload.replicas, workload.readyReplicas))
+	}
+
+	var failing []string
+	for i := range pods {
+		if reason := podFailure(&pods[i]); reason != "" {
+			failing = append(failing, pods[i].Name+": "+reason)
+		}
+	}
+	if len(failing) > 0 {
+		setCondition(m, cachev1alpha1.ConditionDegraded, metav1.ConditionTrue, reasonPodsFailing, strings.Join(failing, ", "))
+	} else {
+		setCondition(m, cachev1alpha1.ConditionDegraded, metav1.ConditionFalse, reasonAsExpected, "no pods are failing")
+	}
+}
+
+func setCondition(m *cachev1alpha1.Memcached, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&m.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: m.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// podFailure returns the reason the pod is failing, or "" if it is not
+func podFailure(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return ""
+	}
+	if pod.Status.Phase == corev1.PodFailed {
+		return string(corev1.PodFailed)
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+			return c.Reason
+		}
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting == nil {
+			continue
+		}
+		switch cs.State.Waiting.Reason {
+		case "CrashLoopBackOff", "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError":
+			return cs.State.Waiting.Reason
+		}
+	}
+	return ""
+}
@@ -91,8 +91,9 @@ var _ = BeforeSuite(func() {
 	// Initialize `MemcachedReconciler` with the manager client schema.
 	// コントローラーの初期化 + Managerへの登録
 	err = (&MemcachedReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: k8sManager.GetScheme(),
+		Client:   k8sManager.GetClient(),
+		Scheme:   k8sManager.GetScheme(),
+		Recorder: k8sManager.GetEventRecorderFor("memcached-controller"),
 	}).SetupWithManager(k8sManager)
 
 	// Start the with a goroutine.
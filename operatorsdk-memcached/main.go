@@ -26,6 +26,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -89,9 +90,26 @@ func main() {
 		os.Exit(1)
 	}
 
+	// ServiceMonitorのCRD（Prometheus Operator）がない場合でもOperatorが動くように、CRDの有無を確認する
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create discovery client")
+		os.Exit(1)
+	}
+	serviceMonitorAvailable, err := controllers.ServiceMonitorAvailable(discoveryClient)
+	if err != nil {
+		setupLog.Error(err, "unable to discover the ServiceMonitor CRD")
+		os.Exit(1)
+	}
+	if !serviceMonitorAvailable {
+		setupLog.Info("ServiceMonitor CRD is not installed. ServiceMonitors are not reconciled")
+	}
+
 	if err = (&controllers.MemcachedReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		ServiceMonitorAvailable: serviceMonitorAvailable,
+		Recorder:                mgr.GetEventRecorderFor("memcached-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Memcached")
 		os.Exit(1)